@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -12,8 +13,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gin-contrib/cors"
 
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/captcha"
 	"github.com/tim-contact/go-crm/internal/config"
 	"github.com/tim-contact/go-crm/internal/db"
+	"github.com/tim-contact/go-crm/internal/inqid"
+	"github.com/tim-contact/go-crm/internal/mail"
 	"github.com/tim-contact/go-crm/internal/server"
 	"github.com/tim-contact/go-crm/migrate"
 )
@@ -21,29 +26,62 @@ import (
 func main() {
 	cfg := config.Load()
 
+	if err := setupAuth(cfg); err != nil {
+		log.Fatalf("auth: %v", err)
+	}
+	if err := inqid.Configure(cfg.InqIDPattern); err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
 	database, err := db.Open(cfg.DB_DSN)
 	if err != nil {
 		log.Fatalf("db open: %v", err)
 	}
  	if err := migrate.RunMigrations(cfg.DB_DSN); err != nil {
-        log.Fatal("Migration: %v", err)
+        log.Fatalf("Migration: %v", err)
     }
 
 	log.Println("Database connected, migrations applied")
 
+	if err := server.FailInterruptedBulkJobs(database); err != nil {
+		log.Fatalf("bulk jobs: %v", err)
+	}
+
+	mailer, err := mail.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("mail: %v", err)
+	}
+
+	verifier, err := captcha.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("captcha: %v", err)
+	}
+	if cfg.Production && cfg.CaptchaProvider == "none" {
+		log.Println("WARNING: CAPTCHA_PROVIDER not set, public inquiries are only rate limited")
+	}
+
 	r := gin.Default()
+	// Client IPs drive the login and inquiry rate limits, so only proxies we
+	// run may set X-Forwarded-For.
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("config: TRUSTED_PROXIES: %v", err)
+	}
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins: []string{"http://localhost:5173", "http://localhost:8082", "https://go-crm-production.up.railway.app", "https://spirited-trust-production.up.railway.app"},
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders: []string{"Content-Length"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match"},
+		ExposeHeaders: []string{"Content-Length", "X-Impersonating", "X-Impersonator", "ETag"},
 		AllowCredentials: true, MaxAge: 12 * time.Hour,
 	}))
 
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	go server.RunLeadPurge(purgeCtx, database, cfg.LeadTrashRetention)
+
 	srv := &http.Server{
 		Addr: ":8081",
-		Handler: server.Router(r, database),
+		Handler: server.Router(r, database, cfg, mailer, verifier),
 	}
 
 
@@ -59,6 +97,7 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	log.Println("Shutdown signal received ...")
+	stopPurge()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel() 
@@ -66,4 +105,30 @@ func main() {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 	log.Println("Server exiting")
-}
\ No newline at end of file
+}
+
+// setupAuth loads the JWT signing keys. Without JWT_KEYS_DIR a throwaway key
+// is generated, which is only allowed outside production.
+func setupAuth(cfg config.Config) error {
+	var keys *auth.KeySet
+	var err error
+	if cfg.JWTKeysDir != "" {
+		keys, err = auth.LoadKeySet(cfg.JWTKeysDir, cfg.JWTActiveKID)
+	} else if cfg.Production {
+		return fmt.Errorf("JWT_KEYS_DIR must be set in production")
+	} else {
+		log.Println("WARNING: JWT_KEYS_DIR not set, signing with an ephemeral key")
+		keys, err = auth.NewEphemeralKeySet()
+	}
+	if err != nil {
+		return err
+	}
+	auth.Configure(auth.Options{
+		Keys:         keys,
+		Issuer:       cfg.JWTIssuer,
+		Audience:     cfg.JWTAudience,
+		LegacySecret: cfg.JWTLegacySecret,
+	})
+	log.Printf("JWT signing key %q (%s), %d key(s) published", keys.Active.ID, keys.Active.Method.Alg(), len(keys.Keys()))
+	return nil
+}
@@ -0,0 +1,159 @@
+// Package allocation picks an owner for a new lead from the admin-defined
+// allocation rules.
+package allocation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// Input is the subset of a lead the rules match on.
+type Input struct {
+	BranchID           *string
+	DestinationCountry *string
+	VisaCategory       *string
+}
+
+// Result is the chosen user and a human-readable explanation that is stored
+// on the lead as allocation_reason.
+type Result struct {
+	UserID string
+	RuleID string
+	Reason string
+}
+
+// Allocate returns the user for the first matching active rule (lowest
+// priority number first) that has an active member, or nil if no rule
+// applies. It must run inside the transaction that creates the lead: the rule
+// row is locked so concurrent round-robin picks don't hand out the same user.
+func Allocate(tx *gorm.DB, in Input) (*Result, error) {
+	var rules []models.AllocationRule
+	if err := tx.Where("active").Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		if !matches(rule, in) {
+			continue
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&models.AllocationRule{}, "id = ?", rule.ID).Error; err != nil {
+			return nil, err
+		}
+
+		pick, err := pickMember(tx, rule)
+		if err != nil {
+			return nil, err
+		}
+		if pick == nil {
+			continue
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.AllocationRuleMember{}).
+			Where("rule_id = ? AND user_id = ?", rule.ID, pick.UserID).
+			Update("last_assigned_at", now).Error; err != nil {
+			return nil, err
+		}
+
+		return &Result{
+			UserID: pick.UserID,
+			RuleID: rule.ID,
+			Reason: fmt.Sprintf("Rule %q (%s): %s; %s", rule.Name, criteria(tx, rule), strategyLabel(rule.Strategy), pick.detail),
+		}, nil
+	}
+	return nil, nil
+}
+
+func matches(rule models.AllocationRule, in Input) bool {
+	return matchField(rule.BranchID, in.BranchID) &&
+		matchField(rule.DestinationCountry, in.DestinationCountry) &&
+		matchField(rule.VisaCategory, in.VisaCategory)
+}
+
+func matchField(want, got *string) bool {
+	if want == nil || *want == "" {
+		return true
+	}
+	return got != nil && strings.EqualFold(strings.TrimSpace(*want), strings.TrimSpace(*got))
+}
+
+type candidate struct {
+	UserID         string
+	UserName       string
+	OpenTasks      int
+	LastAssignedAt *time.Time
+	detail         string
+}
+
+// pickMember chooses among the rule's active members. Round-robin takes
+// whoever was assigned longest ago (never-assigned first); least_open_tasks
+// takes the member with fewest open or in-progress tasks, breaking ties the
+// round-robin way.
+func pickMember(tx *gorm.DB, rule models.AllocationRule) (*candidate, error) {
+	q := tx.Table("allocation_rule_members m").
+		Select(`m.user_id, u.name AS user_name, m.last_assigned_at,
+			(SELECT COUNT(*) FROM tasks t WHERE t.assigned_to = m.user_id AND t.status IN ('open','in_progress')
+				AND NOT EXISTS (SELECT 1 FROM leads dl WHERE dl.id = t.lead_id AND dl.deleted_at IS NOT NULL)) AS open_tasks`).
+		Joins("JOIN users u ON u.id = m.user_id AND u.active = TRUE").
+		Where("m.rule_id = ?", rule.ID)
+
+	if rule.Strategy == models.AllocationLeastOpenTasks {
+		q = q.Order("open_tasks ASC, m.last_assigned_at ASC NULLS FIRST, u.name ASC")
+	} else {
+		q = q.Order("m.last_assigned_at ASC NULLS FIRST, u.name ASC")
+	}
+
+	var c candidate
+	res := q.Limit(1).Scan(&c)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	if rule.Strategy == models.AllocationLeastOpenTasks {
+		c.detail = fmt.Sprintf("%s had the fewest open tasks (%d)", c.UserName, c.OpenTasks)
+	} else if c.LastAssignedAt == nil {
+		c.detail = fmt.Sprintf("%s had not been assigned a lead by this rule yet", c.UserName)
+	} else {
+		c.detail = fmt.Sprintf("%s was next in rotation (last assigned %s)", c.UserName, c.LastAssignedAt.Format(time.RFC3339))
+	}
+	return &c, nil
+}
+
+func criteria(tx *gorm.DB, rule models.AllocationRule) string {
+	var parts []string
+	if rule.BranchID != nil {
+		var b models.Branch
+		if err := tx.Select("name").First(&b, "id = ?", *rule.BranchID).Error; err == nil {
+			parts = append(parts, "branch="+b.Name)
+		} else {
+			parts = append(parts, "branch="+*rule.BranchID)
+		}
+	}
+	if rule.DestinationCountry != nil {
+		parts = append(parts, "country="+*rule.DestinationCountry)
+	}
+	if rule.VisaCategory != nil {
+		parts = append(parts, "visa category="+*rule.VisaCategory)
+	}
+	if len(parts) == 0 {
+		return "catch-all"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func strategyLabel(s models.AllocationStrategy) string {
+	if s == models.AllocationLeastOpenTasks {
+		return "least open tasks"
+	}
+	return "round-robin"
+}
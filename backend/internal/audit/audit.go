@@ -0,0 +1,115 @@
+// Package audit writes rows to audit_logs. Callers pass the transaction that
+// performs the change so the log entry commits or rolls back with it.
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+	ActionTag     = "tag"
+	ActionUntag   = "untag"
+)
+
+// Record logs a change made by the authenticated user on c (and the admin
+// impersonating them, if any). before is nil for
+// creates and after is nil for deletes; for updates only the fields that
+// changed are kept on either side.
+func Record(tx *gorm.DB, c *gin.Context, action, entity, entityID string, before, after any) error {
+	return record(tx, c.GetString("uid"), c.GetString("impersonator_id"), action, entity, entityID, before, after)
+}
+
+// RecordSystem logs a change made by a background job, with no actor.
+func RecordSystem(tx *gorm.DB, action, entity, entityID string, before, after any) error {
+	return record(tx, "", "", action, entity, entityID, before, after)
+}
+
+func record(tx *gorm.DB, uid, imp, action, entity, entityID string, before, after any) error {
+	b, err := toMap(before)
+	if err != nil {
+		return err
+	}
+	a, err := toMap(after)
+	if err != nil {
+		return err
+	}
+	if b != nil && a != nil {
+		b, a = diff(b, a)
+		if len(a) == 0 && len(b) == 0 {
+			return nil
+		}
+	}
+
+	entry := models.AuditLog{
+		Action: action,
+		Entity: entity,
+	}
+	if uid != "" {
+		entry.ActorID = &uid
+	}
+	if imp != "" {
+		entry.ImpersonatorID = &imp
+	}
+	if entityID != "" {
+		entry.EntityID = &entityID
+	}
+	if entry.Before, err = marshal(b); err != nil {
+		return err
+	}
+	if entry.After, err = marshal(a); err != nil {
+		return err
+	}
+	return tx.Create(&entry).Error
+}
+
+func toMap(v any) (map[string]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func diff(before, after map[string]any) (map[string]any, map[string]any) {
+	b, a := map[string]any{}, map[string]any{}
+	for k, av := range after {
+		if bv, ok := before[k]; !ok || !reflect.DeepEqual(bv, av) {
+			b[k] = before[k]
+			a[k] = av
+		}
+	}
+	for k, bv := range before {
+		if _, ok := after[k]; !ok {
+			b[k] = bv
+		}
+	}
+	// updated_at always moves; it is noise in a diff.
+	delete(b, "updated_at")
+	delete(a, "updated_at")
+	return b, a
+}
+
+func marshal(m map[string]any) (json.RawMessage, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
@@ -2,56 +2,163 @@ package auth
 
 import (
 	"time"
-	"os"
-	"fmt"
-	"log"
 	"errors"
-	
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var signingKey = []byte(getEnv("JWT_SECRET", "dev-secret-change-me"))
+// Options configures token signing. Set once at startup with Configure.
+type Options struct {
+	Keys     *KeySet
+	Issuer   string
+	Audience string
+	// LegacySecret, if set, still verifies HS256 tokens issued before the
+	// switch to asymmetric keys. They are short-lived, so it can be dropped
+	// an access-token lifetime after deploying.
+	LegacySecret string
+}
 
-func getEnv(k, def string) string {
-	v := os.Getenv(k)
-	if v == "" {
-		if os.Getenv("GO_ENV") == "production" {
-			log.Fatalf("FATAL: Environment variable %s not set", k)
-		}
-		fmt.Printf("WARNING: Environment variable %s not set, using default value\n", k)
-		return def
-	}
-	return v
+var opts Options
+
+func Configure(o Options) {
+	opts = o
 }
 
+// Keys is the configured key set, for serving the JWKS.
+func Keys() *KeySet {
+	return opts.Keys
+}
 
 type Claims struct {
 	UserID string `json:"uid"`
 	Role   string `json:"role"`
+	TokenVersion int `json:"tv"`
+	// Purpose is empty for access tokens. Tokens minted for a single step
+	// of a flow (e.g. the MFA challenge) carry a purpose and are rejected
+	// by Parse.
+	Purpose string `json:"pur,omitempty"`
+	// ActorID is set on impersonation tokens: the admin really making the
+	// requests, while UserID is the user being viewed as. ActorTokenVersion
+	// is the admin's token version, so revoking their sessions ends it too.
+	ActorID           string `json:"act,omitempty"`
+	ActorTokenVersion int    `json:"atv,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAccessToken (userID, role string, ttl time.Duration) (string, error) {
+const (
+	PurposeMFAChallenge = "mfa"
+	PurposeMFAEnroll    = "mfa_enroll"
 
-	claims := &Claims{
-		UserID: userID,
-		Role: role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-			IssuedAt: jwt.NewNumericDate(time.Now()),
-		},
+	MFATokenTTL = 5 * time.Minute
+	ImpersonationTokenTTL = 30 * time.Minute
+)
+
+func NewAccessToken (userID, role string, tokenVersion int, ttl time.Duration) (string, error) {
+	return sign(Claims{UserID: userID, Role: role, TokenVersion: tokenVersion}, ttl)
+}
+
+// NewImpersonationToken mints an access token for userID that records
+// actorID as the one actually using it. There is no refresh token for it.
+func NewImpersonationToken(userID, role string, tokenVersion int, actorID string, actorTokenVersion int) (string, error) {
+	return sign(Claims{
+		UserID: userID, Role: role, TokenVersion: tokenVersion,
+		ActorID: actorID, ActorTokenVersion: actorTokenVersion,
+	}, ImpersonationTokenTTL)
+}
+
+// NewPurposeToken mints a short-lived token that only proves the password
+// step of login, e.g. to be exchanged for an access token once the TOTP code
+// is checked.
+func NewPurposeToken(userID, role string, tokenVersion int, purpose string, ttl time.Duration) (string, error) {
+	return sign(Claims{UserID: userID, Role: role, TokenVersion: tokenVersion, Purpose: purpose}, ttl)
+}
+
+func sign(claims Claims, ttl time.Duration) (string, error) {
+	if opts.Keys == nil || opts.Keys.Active == nil {
+		return "", errors.New("auth: signing keys not configured")
+	}
+	key := opts.Keys.Active
+
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer: opts.Issuer,
+		Subject: claims.UserID,
+		Audience: jwt.ClaimStrings{opts.Audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt: jwt.NewNumericDate(now),
 	}
 
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(signingKey)
+	tok := jwt.NewWithClaims(key.Method, &claims)
+	tok.Header["kid"] = key.ID
+	return tok.SignedString(key.Private)
 }
 
+// Parse validates an access token.
 func Parse(tokenStr string) (*Claims, error) {
-	tok, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (any, error){
-		return signingKey, nil
-	})
-	if err != nil || !tok.Valid {	
+	claims, err := parse(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// ParsePurpose validates a token minted by NewPurposeToken for purpose.
+func ParsePurpose(tokenStr, purpose string) (*Claims, error) {
+	claims, err := parse(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func parse(tokenStr string) (*Claims, error) {
+	if opts.LegacySecret != "" && isLegacy(tokenStr) {
+		return parseLegacy(tokenStr)
+	}
+	if opts.Keys == nil {
+		return nil, errors.New("invalid token")
+	}
+
+	tok, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := opts.Keys.Lookup(kid)
+		if !ok {
+			return nil, errors.New("unknown kid")
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("algorithm does not match key")
+		}
+		return key.Public, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(opts.Issuer),
+		jwt.WithAudience(opts.Audience),
+		jwt.WithExpirationRequired(),
+	)
+	return claimsOf(tok, err)
+}
+
+func isLegacy(tokenStr string) bool {
+	tok, _, err := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+	return err == nil && tok.Method.Alg() == jwt.SigningMethodHS256.Alg()
+}
+
+func parseLegacy(tokenStr string) (*Claims, error) {
+	tok, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(t *jwt.Token) (any, error) {
+		return []byte(opts.LegacySecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	return claimsOf(tok, err)
+}
+
+func claimsOf(tok *jwt.Token, err error) (*Claims, error) {
+	if err != nil || !tok.Valid {
 		return nil, errors.New("invalid token")
-		
 	}
 
 	claims, ok := tok.Claims.(*Claims)
@@ -59,5 +166,4 @@ func Parse(tokenStr string) (*Claims, error) {
 		return nil, errors.New("bad claims")
 	}
 	return claims, nil
-
-}
\ No newline at end of file
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func configureTestKeys(t *testing.T) {
+	t.Helper()
+	ks, err := NewEphemeralKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := opts
+	Configure(Options{Keys: ks, Issuer: "test", Audience: "test"})
+	t.Cleanup(func() { opts = prev })
+}
+
+func TestImpersonationTokenCarriesActorTokenVersion(t *testing.T) {
+	configureTestKeys(t)
+
+	tok, err := NewImpersonationToken("user-1", "agent", 2, "admin-1", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := Parse(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "user-1" || claims.TokenVersion != 2 {
+		t.Errorf("user = %q v%d, want user-1 v2", claims.UserID, claims.TokenVersion)
+	}
+	if claims.ActorID != "admin-1" || claims.ActorTokenVersion != 7 {
+		t.Errorf("actor = %q v%d, want admin-1 v7", claims.ActorID, claims.ActorTokenVersion)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	configureTestKeys(t)
+	ks := opts.Keys
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := &Key{ID: "foreign", Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}
+	impostor := &Key{ID: ks.Active.ID, Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}
+
+	signWith := func(k *Key, ttl time.Duration, audience string) string {
+		t.Helper()
+		prev := opts
+		opts = Options{Keys: &KeySet{Active: k}, Issuer: prev.Issuer, Audience: audience}
+		defer func() { opts = prev }()
+		tok, err := sign(Claims{UserID: "user-1", Role: "agent"}, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	hs256, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: "user-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: "test", Audience: jwt.ClaimStrings{"test"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa, err := NewPurposeToken("user-1", "agent", 0, PurposeMFAChallenge, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		tok  string
+	}{
+		{"unknown kid", signWith(foreign, time.Minute, "test")},
+		{"wrong key for kid", signWith(impostor, time.Minute, "test")},
+		{"expired", signWith(ks.Active, -time.Minute, "test")},
+		{"wrong audience", signWith(ks.Active, time.Minute, "other")},
+		{"HS256 without a legacy secret", hs256},
+		{"purpose token as access token", mfa},
+		{"garbage", "not.a.jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.tok); err == nil {
+				t.Error("Parse() accepted the token")
+			}
+		})
+	}
+}
+
+func TestParsePurpose(t *testing.T) {
+	configureTestKeys(t)
+
+	access, err := NewAccessToken("user-1", "agent", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enroll, err := NewPurposeToken("user-1", "agent", 0, PurposeMFAEnroll, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParsePurpose(enroll, PurposeMFAEnroll); err != nil {
+		t.Errorf("ParsePurpose(enroll token) = %v", err)
+	}
+	if _, err := ParsePurpose(enroll, PurposeMFAChallenge); err == nil {
+		t.Error("ParsePurpose accepted a token minted for another purpose")
+	}
+	if _, err := ParsePurpose(access, PurposeMFAChallenge); err == nil {
+		t.Error("ParsePurpose accepted an access token")
+	}
+}
+
+func TestParseRetiredKey(t *testing.T) {
+	configureTestKeys(t)
+	old := opts.Keys.Active
+
+	tok, err := NewAccessToken("user-1", "agent", 0, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: a new active key, the old one kept public-only.
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &Key{ID: "next", Method: jwt.SigningMethodEdDSA, Private: priv, Public: pub}
+	retired := &Key{ID: old.ID, Method: old.Method, Public: old.Public}
+	opts.Keys = &KeySet{Active: next, keys: map[string]*Key{next.ID: next, retired.ID: retired}}
+
+	if _, err := Parse(tok); err != nil {
+		t.Errorf("token signed with a retired key rejected: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeKey(t *testing.T, dir, kid string, public bool) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if public {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	} else {
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01", true)
+	writeKey(t, dir, "2024-06", false)
+
+	ks, err := LoadKeySet(dir, "2024-06")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Active.ID != "2024-06" {
+		t.Errorf("active = %q, want 2024-06", ks.Active.ID)
+	}
+	if jwks := ks.JWKS(); len(jwks) != 2 || jwks[0].Kid != "2024-01" || jwks[0].Kty != "OKP" {
+		t.Errorf("JWKS() = %+v, want both keys, retired first", jwks)
+	}
+
+	if _, err := LoadKeySet(dir, "2024-01"); err == nil {
+		t.Error("a public-only key was accepted as the active key")
+	}
+	if _, err := LoadKeySet(dir, "missing"); err == nil {
+		t.Error("an unknown active kid was accepted")
+	}
+	if _, err := LoadKeySet(dir, ""); err == nil {
+		t.Error("no active kid with several keys was accepted")
+	}
+	if _, err := LoadKeySet(t.TempDir(), ""); err == nil {
+		t.Error("an empty key directory was accepted")
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	AccessTokenTTL        = 60 * time.Minute
+	RefreshTokenTTL       = 30 * 24 * time.Hour
+	PasswordResetTokenTTL = time.Hour
+)
+
+// NewOpaqueToken returns a random token (refresh, password reset, ...) and the
+// hash that is stored server-side. Only the hash is ever persisted.
+func NewOpaqueToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix marks a credential as an API key rather than a JWT.
+const APIKeyPrefix = "crm_"
+
+// NewAPIKey returns a key of the form crm_<id>.<secret>. The crm_<id> part is
+// stored in clear so keys can be recognised in logs and looked up; only the
+// hash of the whole key is kept.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	secret, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	key = prefix + "." + secret
+	return key, prefix, HashToken(key), nil
+}
+
+// SplitAPIKey returns the lookup prefix of key, or false if key isn't shaped
+// like an API key.
+func SplitAPIKey(key string) (prefix string, ok bool) {
+	prefix, _, ok = strings.Cut(key, ".")
+	if !ok || !strings.HasPrefix(prefix, APIKeyPrefix) {
+		return "", false
+	}
+	return prefix, true
+}
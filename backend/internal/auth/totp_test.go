@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 SHA-1 vectors, truncated to 6 digits.
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	tests := []struct {
+		name     string
+		code     string
+		at       int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", "287082", 59, 1, true},
+		{"spaces ignored", "287 082", 59, 1, true},
+		{"previous step within skew", "287082", 89, 1, true},
+		{"outside skew", "287082", 119, 0, false},
+		{"other vector", "081804", 1111111109, 37037036, true},
+		{"wrong length", "28708", 59, 0, false},
+		{"wrong code", "287083", 59, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP() = %d, %v; want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
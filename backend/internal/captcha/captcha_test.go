@@ -0,0 +1,84 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/config"
+)
+
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{"disabled by default", config.Config{}, false},
+		{"test verifier", config.Config{CaptchaProvider: "test", CaptchaTestToken: "ok"}, false},
+		{"provider needs a secret", config.Config{CaptchaProvider: "turnstile"}, true},
+		{"provider with secret", config.Config{CaptchaProvider: "hcaptcha", CaptchaSecret: "s"}, false},
+		{"unknown provider", config.Config{CaptchaProvider: "sudoku"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTestVerifier(t *testing.T) {
+	ctx := context.Background()
+	if err := (TestVerifier{Token: "ok"}).Verify(ctx, "ok", ""); err != nil {
+		t.Errorf("matching token rejected: %v", err)
+	}
+	if err := (TestVerifier{Token: "ok"}).Verify(ctx, "nope", ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("wrong token = %v, want ErrFailed", err)
+	}
+	if err := (TestVerifier{}).Verify(ctx, "", ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("unset token = %v, want ErrFailed", err)
+	}
+}
+
+func TestSiteVerifier(t *testing.T) {
+	var gotIP string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		gotIP = r.PostForm.Get("remoteip")
+		switch r.PostForm.Get("response") {
+		case "good":
+			w.Write([]byte(`{"success": true}`))
+		case "down":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"success": false, "error-codes": ["invalid-input-response"]}`))
+		}
+	}))
+	defer srv.Close()
+	v := &SiteVerifier{Endpoint: srv.URL, Secret: "s", Client: srv.Client()}
+	ctx := context.Background()
+
+	if err := v.Verify(ctx, "good", "203.0.113.9"); err != nil {
+		t.Errorf("good token rejected: %v", err)
+	}
+	if gotIP != "203.0.113.9" {
+		t.Errorf("remoteip = %q, want 203.0.113.9", gotIP)
+	}
+	if err := v.Verify(ctx, "bad", ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("bad token = %v, want ErrFailed", err)
+	}
+	if err := v.Verify(ctx, "", ""); !errors.Is(err, ErrFailed) {
+		t.Errorf("empty token = %v, want ErrFailed", err)
+	}
+	// An outage is not the submitter's fault: a plain error, not ErrFailed.
+	if err := v.Verify(ctx, "down", ""); err == nil || errors.Is(err, ErrFailed) {
+		t.Errorf("provider error = %v, want a non-ErrFailed error", err)
+	}
+}
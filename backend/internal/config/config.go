@@ -3,10 +3,85 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	DB_DSN string
+	Production bool
+
+	// JWTKeysDir holds the PEM signing keys, one <kid>.pem per key.
+	// JWTActiveKID names the key that signs new tokens.
+	JWTKeysDir   string
+	JWTActiveKID string
+	JWTIssuer    string
+	JWTAudience  string
+	// JWTLegacySecret verifies HS256 tokens issued before the key switch.
+	JWTLegacySecret string
+
+	// TrustedProxies are the reverse proxies (IPs or CIDRs) whose
+	// X-Forwarded-For is believed when working out a client's IP for rate
+	// limits. Empty means none: the connection's address is used.
+	TrustedProxies []string
+
+	// Base URL of the frontend, used to build links in emails.
+	AppBaseURL string
+
+	// MailDriver is "smtp", "file" or "log" (default, not allowed in
+	// production).
+	MailDriver   string
+	MailFrom     string
+	MailFileDir  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// OIDC single sign-on; disabled unless OIDCIssuerURL is set.
+	OIDCIssuerURL    string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is this API's /auth/oidc/callback as the provider sees it.
+	OIDCRedirectURL string
+	OIDCScopes      []string
+	// OIDCAutoProvision creates unknown users with OIDCDefaultRole, limited
+	// to OIDCAllowedDomains when set.
+	OIDCAutoProvision  bool
+	OIDCDefaultRole    string
+	OIDCAllowedDomains []string
+
+	// LeadTrashRetention is how long deleted leads stay restorable before
+	// the purge job removes them and their history for good.
+	LeadTrashRetention time.Duration
+
+	// InqIDPattern formats generated INQ IDs, e.g. {BRANCH}-{YYYY}-{SEQ:5}.
+	InqIDPattern string
+
+	// CaptchaProvider guards the public inquiry form: "turnstile",
+	// "hcaptcha", "recaptcha", "test" or "none" (default).
+	CaptchaProvider  string
+	CaptchaSecret    string
+	CaptchaTestToken string
+	// InquiryDefaultBranch receives public inquiries that don't name a
+	// known branch.
+	InquiryDefaultBranch string
+
+	// MFAIssuer is the account label shown in authenticator apps.
+	MFAIssuer string
+	// MFARequiredRoles must enroll in TOTP before they can sign in.
+	MFARequiredRoles []string
+}
+
+// MFARequired reports whether users with role must use two-factor auth.
+func (c Config) MFARequired(role string) bool {
+	for _, r := range c.MFARequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
 
 func Load() Config {
@@ -16,5 +91,74 @@ func Load() Config {
 	}
 	return Config{
 		DB_DSN: dsn,
+		Production: os.Getenv("GO_ENV") == "production",
+
+		JWTKeysDir:      os.Getenv("JWT_KEYS_DIR"),
+		JWTActiveKID:    os.Getenv("JWT_ACTIVE_KID"),
+		JWTIssuer:       getEnv("JWT_ISSUER", "go-crm"),
+		JWTAudience:     getEnv("JWT_AUDIENCE", "go-crm-api"),
+		JWTLegacySecret: os.Getenv("JWT_SECRET"),
+
+		TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+
+		AppBaseURL: getEnv("APP_BASE_URL", "http://localhost:5173"),
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "CRM <no-reply@localhost>"),
+		MailFileDir:  getEnv("MAIL_FILE_DIR", "mail"),
+		SMTPHost:     os.Getenv("SMTP_HOST"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+
+		OIDCIssuerURL:      os.Getenv("OIDC_ISSUER_URL"),
+		OIDCClientID:       os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:   os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:    getEnv("OIDC_REDIRECT_URL", "http://localhost:8081/auth/oidc/callback"),
+		OIDCScopes:         splitList(getEnv("OIDC_SCOPES", "openid,email,profile")),
+		OIDCAutoProvision:  os.Getenv("OIDC_AUTO_PROVISION") == "true",
+		OIDCDefaultRole:    getEnv("OIDC_DEFAULT_ROLE", "viewer"),
+		OIDCAllowedDomains: splitList(strings.ToLower(os.Getenv("OIDC_ALLOWED_DOMAINS"))),
+
+		LeadTrashRetention: time.Duration(getEnvInt("LEAD_TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+
+		InqIDPattern: getEnv("INQ_ID_PATTERN", "{BRANCH}-{YYYY}-{SEQ:5}"),
+
+		CaptchaProvider:      getEnv("CAPTCHA_PROVIDER", "none"),
+		CaptchaSecret:        os.Getenv("CAPTCHA_SECRET"),
+		CaptchaTestToken:     getEnv("CAPTCHA_TEST_TOKEN", "test-pass"),
+		InquiryDefaultBranch: os.Getenv("INQUIRY_DEFAULT_BRANCH"),
+
+		MFAIssuer:        getEnv("MFA_ISSUER", "Go CRM"),
+		MFARequiredRoles: splitList(os.Getenv("MFA_REQUIRED_ROLES")),
+	}
+}
+
+func getEnv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
 	}
-}
\ No newline at end of file
+	return def
+}
+
+func getEnvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("%s must be a whole number, got %q", k, v)
+	}
+	return n
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
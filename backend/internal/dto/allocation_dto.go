@@ -0,0 +1,50 @@
+package dto
+
+import "time"
+
+type AllocationRuleMember struct {
+	UserID         string     `json:"user_id"`
+	Name           string     `json:"name"`
+	LastAssignedAt *time.Time `json:"last_assigned_at,omitempty"`
+}
+
+type AllocationRuleResponse struct {
+	ID                 string                 `json:"id"`
+	Name               string                 `json:"name"`
+	Priority           int                    `json:"priority"`
+	Active             bool                   `json:"active"`
+	BranchID           *string                `json:"branch_id,omitempty"`
+	DestinationCountry *string                `json:"destination_country,omitempty"`
+	VisaCategory       *string                `json:"visa_category,omitempty"`
+	Strategy           string                 `json:"strategy"`
+	Members            []AllocationRuleMember `json:"members"`
+	CreatedAt          time.Time              `json:"created_at"`
+	UpdatedAt          time.Time              `json:"updated_at"`
+}
+
+type AllocationRuleListResponse struct {
+	Rules      []AllocationRuleResponse `json:"rules"`
+	TotalCount int                      `json:"total_count"`
+}
+
+type CreateAllocationRule struct {
+	Name               string   `json:"name" binding:"required,min=2"`
+	Priority           *int     `json:"priority,omitempty"`
+	Active             *bool    `json:"active,omitempty"`
+	BranchID           *string  `json:"branch_id,omitempty"`
+	DestinationCountry *string  `json:"destination_country,omitempty"`
+	VisaCategory       *string  `json:"visa_category,omitempty"`
+	Strategy           string   `json:"strategy" binding:"required,oneof=round_robin least_open_tasks"`
+	UserIDs            []string `json:"user_ids"`
+}
+
+type UpdateAllocationRule struct {
+	Name               *string   `json:"name,omitempty" binding:"omitempty,min=2"`
+	Priority           *int      `json:"priority,omitempty"`
+	Active             *bool     `json:"active,omitempty"`
+	BranchID           *string   `json:"branch_id,omitempty"`
+	DestinationCountry *string   `json:"destination_country,omitempty"`
+	VisaCategory       *string   `json:"visa_category,omitempty"`
+	Strategy           *string   `json:"strategy,omitempty" binding:"omitempty,oneof=round_robin least_open_tasks"`
+	UserIDs            *[]string `json:"user_ids,omitempty"`
+}
@@ -0,0 +1,37 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditQuery struct {
+	Entity   string `form:"entity"`
+	EntityID string `form:"entity_id"`
+	ActorID  string `form:"actor"` // matches the acting or impersonating user
+	From     string `form:"from"`  // YYYY-MM-DD or RFC3339
+	To       string `form:"to"`
+	Limit    int    `form:"limit,default=50"`
+	Offset   int    `form:"offset,default=0"`
+}
+
+type AuditLogResponse struct {
+	ID               string          `json:"id"`
+	ActorID          *string         `json:"actor_id,omitempty"`
+	ActorName        *string         `json:"actor_name,omitempty"`
+	ImpersonatorID   *string         `json:"impersonator_id,omitempty"`
+	ImpersonatorName *string         `json:"impersonator_name,omitempty"`
+	Action           string          `json:"action"`
+	Entity           string          `json:"entity"`
+	EntityID         *string         `json:"entity_id,omitempty"`
+	Before           json.RawMessage `json:"before,omitempty"`
+	After            json.RawMessage `json:"after,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
+
+type AuditLogListResponse struct {
+	AuditLogs  []AuditLogResponse `json:"audit_logs"`
+	TotalCount int                `json:"total_count"`
+	Limit      int                `json:"limit"`
+	Offset     int                `json:"offset"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+type BranchResponse struct {
+	ID   string  `json:"id"`
+	Name string  `json:"name"`
+	Code *string `json:"code"`
+}
+
+type CreateBranch struct {
+	Name string  `json:"name" binding:"required,min=2,max=100"`
+	Code *string `json:"code" binding:"omitempty,alphanum,max=10"`
+}
+
+// UpdateBranch changes the name and/or code; a blank code clears it.
+type UpdateBranch struct {
+	Name *string `json:"name,omitempty" binding:"omitempty,min=2,max=100"`
+	Code *string `json:"code,omitempty" binding:"omitempty,alphanum,max=10"`
+}
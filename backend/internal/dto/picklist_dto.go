@@ -0,0 +1,19 @@
+package dto
+
+type PicklistOptionResponse struct {
+	ID       string `json:"id"`
+	Value    string `json:"value"`
+	Position int    `json:"position"`
+	Active   bool   `json:"active"`
+}
+
+type CreatePicklistOption struct {
+	Value    string `json:"value" binding:"required,min=1,max=100"`
+	Position int    `json:"position"`
+}
+
+type UpdatePicklistOption struct {
+	Value    *string `json:"value,omitempty" binding:"omitempty,min=1,max=100"`
+	Position *int    `json:"position,omitempty"`
+	Active   *bool   `json:"active,omitempty"`
+}
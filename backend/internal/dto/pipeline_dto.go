@@ -0,0 +1,57 @@
+package dto
+
+import "time"
+
+type LeadStatusResponse struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Position   int     `json:"position"`
+	IsInitial  bool    `json:"is_initial"`
+	IsTerminal bool    `json:"is_terminal"`
+	Color      *string `json:"color,omitempty"`
+}
+
+type StatusTransition struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+type PipelineResponse struct {
+	Statuses    []LeadStatusResponse `json:"statuses"`
+	Transitions []StatusTransition   `json:"transitions"`
+}
+
+type CreateLeadStatus struct {
+	Name       string  `json:"name" binding:"required,min=2"`
+	Position   int     `json:"position"`
+	IsInitial  bool    `json:"is_initial"`
+	IsTerminal bool    `json:"is_terminal"`
+	Color      *string `json:"color,omitempty"`
+}
+
+type UpdateLeadStatus struct {
+	Name       *string `json:"name,omitempty" binding:"omitempty,min=2"`
+	Position   *int    `json:"position,omitempty"`
+	IsInitial  *bool   `json:"is_initial,omitempty"`
+	IsTerminal *bool   `json:"is_terminal,omitempty"`
+	Color      *string `json:"color,omitempty"`
+}
+
+type ReplaceTransitions struct {
+	Transitions []StatusTransition `json:"transitions" binding:"dive"`
+}
+
+type StatusHistoryResponse struct {
+	ID            string    `json:"id"`
+	LeadID        string    `json:"lead_id"`
+	FromStatus    *string   `json:"from_status,omitempty"`
+	ToStatus      string    `json:"to_status"`
+	ChangedBy     *string   `json:"changed_by,omitempty"`
+	ChangedByName *string   `json:"changed_by_name,omitempty"`
+	ChangedAt     time.Time `json:"changed_at"`
+}
+
+type StatusHistoryListResponse struct {
+	History    []StatusHistoryResponse `json:"history"`
+	TotalCount int                     `json:"total_count"`
+}
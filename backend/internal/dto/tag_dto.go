@@ -0,0 +1,21 @@
+package dto
+
+type TagResponse struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+}
+
+type CreateTag struct {
+	Name  string  `json:"name" binding:"required,min=1,max=50"`
+	Color *string `json:"color" binding:"omitempty,max=30"`
+}
+
+type UpdateTag struct {
+	Name  *string `json:"name,omitempty" binding:"omitempty,min=1,max=50"`
+	Color *string `json:"color,omitempty" binding:"omitempty,max=30"`
+}
+
+type AddLeadTag struct {
+	TagID string `json:"tag_id" binding:"required"`
+}
@@ -20,6 +20,7 @@ type TaskResponse struct {
 	AssignedTo *string    `json:"assigned_to,omitempty"`
 	AssignedToName *string `json:"assigned_to_name,omitempty"`
 	CreatedAt  time.Time  `json:"created_at"`
+	Version    int        `json:"version"`
 }
 
 type TaskListResponse struct {
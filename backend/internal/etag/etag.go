@@ -0,0 +1,38 @@
+// Package etag builds the entity tags used for optimistic concurrency:
+// clients send back the ETag they last read as If-Match, and a write based on
+// a stale copy is refused with 412 Precondition Failed.
+package etag
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FromTime tags a row by its updated_at. Postgres keeps microseconds and
+// the driver truncates the rest, so the tag is the same whether t came from
+// the database or from Go.
+func FromTime(t time.Time) string {
+	return `"` + strconv.FormatInt(t.Truncate(time.Microsecond).UnixMicro(), 36) + `"`
+}
+
+// FromVersion tags a row by its version counter.
+func FromVersion(v int) string {
+	return `"v` + strconv.Itoa(v) + `"`
+}
+
+// Matches reports whether an If-Match header allows writing a resource whose
+// current tag is current. If-Match is optional, so an empty header matches.
+// Weak tags never match, as RFC 9110 requires for If-Match.
+func Matches(ifMatch, current string) bool {
+	ifMatch = strings.TrimSpace(ifMatch)
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package etag
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	current := FromVersion(3)
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    bool
+	}{
+		{"no header", "", true},
+		{"blank header", "  ", true},
+		{"any", "*", true},
+		{"same tag", `"v3"`, true},
+		{"stale tag", `"v2"`, false},
+		{"unquoted", "v3", false},
+		{"list containing tag", `"v1", "v3"`, true},
+		{"list without spaces", `"v1","v3"`, true},
+		{"list without tag", `"v1", "v2"`, false},
+		{"weak tag", `W/"v3"`, false},
+		{"weak and strong", `W/"v3", "v3"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Matches(tt.ifMatch, current); got != tt.want {
+				t.Errorf("Matches(%q, %q) = %v, want %v", tt.ifMatch, current, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromTime(t *testing.T) {
+	at := time.Date(2025, time.May, 1, 10, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		name string
+		a, b time.Time
+		same bool
+	}{
+		// Postgres stores microseconds, truncated by the driver; the
+		// nanoseconds Go had must not matter.
+		{"database precision", at, at.Truncate(time.Microsecond), true},
+		{"not rounded up", at, at.Round(time.Microsecond), false},
+		{"other zone", at, at.In(time.FixedZone("IST", 19800)), true},
+		{"one microsecond later", at, at.Add(time.Microsecond), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FromTime(tt.a) == FromTime(tt.b); got != tt.same {
+				t.Errorf("FromTime(%v) = %s, FromTime(%v) = %s; same = %v, want %v",
+					tt.a, FromTime(tt.a), tt.b, FromTime(tt.b), got, tt.same)
+			}
+		})
+	}
+}
@@ -6,8 +6,10 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"github.com/tim-contact/go-crm/internal/audit"
 	"github.com/tim-contact/go-crm/internal/dto"
 	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pipeline"
 )
 
 type ActivityHandler struct {
@@ -43,12 +45,11 @@ func (h *ActivityHandler) CreateActivity(c *gin.Context) {
 		if err := tx.Create(&activity).Error; err != nil {
 			return err
 		}
+		if err := audit.Record(tx, c, audit.ActionCreate, "activity", activity.ID, nil, activity); err != nil {
+			return err
+		}
 		if activity.Kind != models.ActivityNote {
-			if err := tx.Model(&models.Lead{}).
-				Where("id = ? AND status = ?", leadID, "New").
-				Update("status", "In Progress").Error; err != nil {
-				return err
-			}
+			return advanceFromInitialStatus(tx, c, leadID)
 		}
 		return nil
 	}); err != nil {
@@ -59,6 +60,38 @@ func (h *ActivityHandler) CreateActivity(c *gin.Context) {
 	c.JSON(http.StatusCreated, activity)
 }
 
+// advanceFromInitialStatus moves a lead still in the pipeline's initial status
+// (e.g. "New") to the next stage once staff have actually contacted them.
+func advanceFromInitialStatus(tx *gorm.DB, c *gin.Context, leadID string) error {
+	pl, err := pipeline.Load(tx)
+	if err != nil {
+		return err
+	}
+	initial, ok := pl.Initial()
+	if !ok {
+		return nil
+	}
+	next, ok := pl.Next(initial)
+	if !ok {
+		return nil
+	}
+
+	res := tx.Model(&models.Lead{}).
+		Where("id = ? AND status = ?", leadID, initial.Name).
+		Update("status", next.Name)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	if err := pipeline.RecordChange(tx, leadID, &initial.Name, next.Name, c.GetString("uid")); err != nil {
+		return err
+	}
+	return audit.Record(tx, c, audit.ActionUpdate, "lead", leadID,
+		gin.H{"status": initial.Name}, gin.H{"status": next.Name})
+}
+
 func (h *ActivityHandler) GetActivities(c *gin.Context) {
 	leadID := c.Param("id")
 
@@ -101,7 +134,7 @@ func (h *ActivityHandler) UpdateActivity(c *gin.Context) {
 
 	var activity models.Activity
 
-	if err := h.db.Where("id = ? AND staff_id = ?", activityID, userID).First(&activity).Error;
+	if err := h.db.Where("id = ? AND lead_id = ? AND staff_id = ?", activityID, c.Param("id"), userID).First(&activity).Error;
 	err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "activity not found"})
@@ -111,8 +144,14 @@ func (h *ActivityHandler) UpdateActivity(c *gin.Context) {
 		return
 	}
 
+	before := activity
 	activity.Summary = req.Summary
-	if err := h.db.Save(&activity).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&activity).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "activity", activity.ID, before, activity)
+	}); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error" : "Failed to update activity"})
 		return
 	}
@@ -134,15 +173,23 @@ func (h *ActivityHandler) DeleteActivity (c *gin.Context) {
 	activityID := c.Param("activity_id")
 	userID, _ := c.Get("uid")
 
-	result := h.db.Delete(&models.Activity{}, "id = ? AND staff_id = ?", activityID, userID)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete activitiy"})
+	var activity models.Activity
+	if err := h.db.Where("id = ? AND lead_id = ? AND staff_id = ?", activityID, c.Param("id"), userID).First(&activity).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database Error"})
+		}
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&activity).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "activity", activity.ID, activity, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete activitiy"})
 		return
 	}
 
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+type AllocationRuleHandler struct {
+	db *gorm.DB
+}
+
+func NewAllocationRuleHandler(db *gorm.DB) *AllocationRuleHandler {
+	return &AllocationRuleHandler{db: db}
+}
+
+func (h *AllocationRuleHandler) ListRules(c *gin.Context) {
+	var rules []models.AllocationRule
+	if err := h.db.Order("priority ASC, created_at ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]dto.AllocationRuleResponse, len(rules))
+	for i, rule := range rules {
+		out, err := h.ruleResponse(h.db, rule)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		response[i] = *out
+	}
+
+	c.JSON(http.StatusOK, dto.AllocationRuleListResponse{Rules: response, TotalCount: len(response)})
+}
+
+func (h *AllocationRuleHandler) CreateRule(c *gin.Context) {
+	var req dto.CreateAllocationRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.AllocationRule{
+		Name:               req.Name,
+		Priority:           100,
+		Active:             true,
+		BranchID:           emptyToNil(req.BranchID),
+		DestinationCountry: emptyToNil(req.DestinationCountry),
+		VisaCategory:       emptyToNil(req.VisaCategory),
+		Strategy:           models.AllocationStrategy(req.Strategy),
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+
+	var out *dto.AllocationRuleResponse
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rule).Error; err != nil {
+			return err
+		}
+		if err := setRuleMembers(tx, rule.ID, req.UserIDs); err != nil {
+			return err
+		}
+		var err error
+		if out, err = h.ruleResponse(tx, rule); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "allocation_rule", rule.ID, nil, out)
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, out)
+}
+
+func (h *AllocationRuleHandler) UpdateRule(c *gin.Context) {
+	ruleID := c.Param("rule_id")
+
+	var req dto.UpdateAllocationRule
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule models.AllocationRule
+	if err := h.db.First(&rule, "id = ?", ruleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// An empty string clears a match field back to "any".
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Active != nil {
+		rule.Active = *req.Active
+	}
+	if req.BranchID != nil {
+		rule.BranchID = emptyToNil(req.BranchID)
+	}
+	if req.DestinationCountry != nil {
+		rule.DestinationCountry = emptyToNil(req.DestinationCountry)
+	}
+	if req.VisaCategory != nil {
+		rule.VisaCategory = emptyToNil(req.VisaCategory)
+	}
+	if req.Strategy != nil {
+		rule.Strategy = models.AllocationStrategy(*req.Strategy)
+	}
+
+	var out *dto.AllocationRuleResponse
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		before, err := h.ruleResponse(tx, rule)
+		if err != nil {
+			return err
+		}
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		if req.UserIDs != nil {
+			if err := setRuleMembers(tx, rule.ID, *req.UserIDs); err != nil {
+				return err
+			}
+		}
+		if out, err = h.ruleResponse(tx, rule); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "allocation_rule", rule.ID, before, out)
+	}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *AllocationRuleHandler) DeleteRule(c *gin.Context) {
+	ruleID := c.Param("rule_id")
+
+	var rule models.AllocationRule
+	if err := h.db.First(&rule, "id = ?", ruleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&rule).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "allocation_rule", rule.ID, rule, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// setRuleMembers replaces the rule's members, keeping the rotation position
+// of users who stay on the rule.
+func setRuleMembers(tx *gorm.DB, ruleID string, userIDs []string) error {
+	if err := tx.Where("rule_id = ? AND user_id NOT IN ?", ruleID, append([]string{""}, userIDs...)).
+		Delete(&models.AllocationRuleMember{}).Error; err != nil {
+		return err
+	}
+	for _, uid := range userIDs {
+		if err := tx.Exec(
+			`INSERT INTO allocation_rule_members (rule_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+			ruleID, uid,
+		).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *AllocationRuleHandler) ruleResponse(db *gorm.DB, rule models.AllocationRule) (*dto.AllocationRuleResponse, error) {
+	members := []dto.AllocationRuleMember{}
+	if err := db.Table("allocation_rule_members m").
+		Select("m.user_id, u.name, m.last_assigned_at").
+		Joins("JOIN users u ON u.id = m.user_id").
+		Where("m.rule_id = ?", rule.ID).
+		Order("u.name ASC").
+		Scan(&members).Error; err != nil {
+		return nil, err
+	}
+
+	return &dto.AllocationRuleResponse{
+		ID:                 rule.ID,
+		Name:               rule.Name,
+		Priority:           rule.Priority,
+		Active:             rule.Active,
+		BranchID:           rule.BranchID,
+		DestinationCountry: rule.DestinationCountry,
+		VisaCategory:       rule.VisaCategory,
+		Strategy:           string(rule.Strategy),
+		Members:            members,
+		CreatedAt:          rule.CreatedAt,
+		UpdatedAt:          rule.UpdatedAt,
+	}, nil
+}
+
+func emptyToNil(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+type AuditHandler struct {
+	db *gorm.DB
+}
+
+func NewAuditHandler(db *gorm.DB) *AuditHandler {
+	return &AuditHandler{db: db}
+}
+
+type auditLogWithActor struct {
+	models.AuditLog
+	ActorName *string `gorm:"column:actor_name"`
+	ImpersonatorName *string `gorm:"column:impersonator_name"`
+}
+
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	var q dto.AuditQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"})
+		return
+	}
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	base := h.db.
+		Table("audit_logs a").
+		Select("a.*, u.name AS actor_name, iu.name AS impersonator_name").
+		Joins("LEFT JOIN users u ON u.id = a.actor_id").
+		Joins("LEFT JOIN users iu ON iu.id = a.impersonator_id")
+
+	if q.Entity != "" {
+		base = base.Where("a.entity = ?", q.Entity)
+	}
+	if q.EntityID != "" {
+		base = base.Where("a.entity_id = ?", q.EntityID)
+	}
+	if q.ActorID != "" {
+		base = base.Where("(a.actor_id = ? OR a.impersonator_id = ?)", q.ActorID, q.ActorID)
+	}
+	if q.From != "" {
+		from, err := parseDateParam(q.From)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from date"})
+			return
+		}
+		base = base.Where("a.created_at >= ?", from)
+	}
+	if q.To != "" {
+		to, err := parseDateParam(q.To)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to date"})
+			return
+		}
+		// A bare date means the whole day.
+		if len(q.To) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		base = base.Where("a.created_at < ?", to)
+	}
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rows []auditLogWithActor
+	if err := base.
+		Order("a.created_at DESC, a.id DESC").
+		Limit(q.Limit).
+		Offset(q.Offset).
+		Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]dto.AuditLogResponse, len(rows))
+	for i, row := range rows {
+		response[i] = dto.AuditLogResponse{
+			ID:        row.ID,
+			ActorID:   row.ActorID,
+			ActorName: row.ActorName,
+			ImpersonatorID: row.ImpersonatorID,
+			ImpersonatorName: row.ImpersonatorName,
+			Action:    row.Action,
+			Entity:    row.Entity,
+			EntityID:  row.EntityID,
+			Before:    row.Before,
+			After:     row.After,
+			CreatedAt: row.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.AuditLogListResponse{
+		AuditLogs:  response,
+		TotalCount: int(total),
+		Limit:      q.Limit,
+		Offset:     q.Offset,
+	})
+}
+
+func parseDateParam(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
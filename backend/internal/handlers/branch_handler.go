@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+)
+
+type BranchHandler struct {
+	db *gorm.DB
+}
+
+func NewBranchHandler(db *gorm.DB) *BranchHandler {
+	return &BranchHandler{db: db}
+}
+
+func (h *BranchHandler) ListBranches(c *gin.Context) {
+	var branches []models.Branch
+	if err := h.db.Order("lower(name)").Find(&branches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := make([]dto.BranchResponse, len(branches))
+	for i, b := range branches {
+		out[i] = toBranchResponse(b)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *BranchHandler) CreateBranch(c *gin.Context) {
+	var req dto.CreateBranch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	branch := models.Branch{Name: strings.TrimSpace(req.Name), Code: branchCode(req.Code)}
+	if branch.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&branch).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "branch", branch.ID, nil, branch)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "a branch with that name or code already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, toBranchResponse(branch))
+}
+
+// UpdateBranch renames a branch or sets its code. The code only affects INQ
+// IDs generated afterwards.
+func (h *BranchHandler) UpdateBranch(c *gin.Context) {
+	var branch models.Branch
+	if err := h.db.First(&branch, "id::text = ?", c.Param("branch_id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "branch not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	var req dto.UpdateBranch
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before := branch
+
+	if req.Name != nil {
+		branch.Name = strings.TrimSpace(*req.Name)
+		if branch.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+	}
+	if req.Code != nil {
+		branch.Code = branchCode(req.Code)
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&branch).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "branch", branch.ID, before, branch)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "another branch has that name or code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toBranchResponse(branch))
+}
+
+// branchCode upper-cases the code; blank means none.
+func branchCode(code *string) *string {
+	if code == nil {
+		return nil
+	}
+	v := strings.ToUpper(strings.TrimSpace(*code))
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func toBranchResponse(b models.Branch) dto.BranchResponse {
+	return dto.BranchResponse{ID: b.ID, Name: b.Name, Code: b.Code}
+}
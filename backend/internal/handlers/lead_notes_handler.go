@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"github.com/tim-contact/go-crm/internal/audit"
 	"github.com/tim-contact/go-crm/internal/dto"
 	"github.com/tim-contact/go-crm/internal/models"
 )
@@ -36,7 +37,12 @@ func (h *LeadNoteHandler) CreateLeadNote(c *gin.Context) {
 		CreatedBy: userID.(string),
 	}
 
-	if err := h.db.Create(&note).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&note).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "lead_note", note.ID, nil, note)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -80,7 +86,7 @@ func (h *LeadNoteHandler) UpdateLeadNote(c *gin.Context) {
 	}
 
 	var note models.LeadNote
-	if err := h.db.Where("id = ? AND created_by = ?", noteID, userID).First(&note).Error; 
+	if err := h.db.Where("id = ? AND lead_id = ? AND created_by = ?", noteID, c.Param("id"), userID).First(&note).Error; 
 	err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "note not found"})
@@ -90,8 +96,14 @@ func (h *LeadNoteHandler) UpdateLeadNote(c *gin.Context) {
 		return
 	}
 
+	before := note
 	note.Body = req.Body
-	if err := h.db.Save(&note).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&note).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "lead_note", note.ID, before, note)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error" : "Falied  to update note"})
 		return
 	}
@@ -111,15 +123,24 @@ func (h *LeadNoteHandler) DeleteLeadNote (c *gin.Context) {
 	noteID := c.Param("note_id")
 	userID, _ := c.Get("uid")
 
-	result := h.db.Delete(&models.LeadNote{}, "id = ? and created_by = ?", noteID, userID)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node"})
+	var note models.LeadNote
+	if err := h.db.Where("id = ? AND lead_id = ? AND created_by = ?", noteID, c.Param("id"), userID).First(&note).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database Error"})
+		}
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&note).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "lead_note", note.ID, note, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node"})
+		return
 	}
 
 	c.Status(http.StatusOK)
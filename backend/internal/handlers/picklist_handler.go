@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+	"github.com/tim-contact/go-crm/internal/picklist"
+)
+
+type PicklistHandler struct {
+	db *gorm.DB
+}
+
+func NewPicklistHandler(db *gorm.DB) *PicklistHandler {
+	return &PicklistHandler{db: db}
+}
+
+// ListPicklists returns every managed list keyed by name, inactive options
+// included so forms can still show a lead's current value.
+func (h *PicklistHandler) ListPicklists(c *gin.Context) {
+	out := map[string][]dto.PicklistOptionResponse{}
+	for _, list := range picklist.Lists {
+		p, err := picklist.Load(h.db, list)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out[list] = toPicklistOptionResponses(p.Options)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *PicklistHandler) GetPicklist(c *gin.Context) {
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	p, err := picklist.Load(h.db, list)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toPicklistOptionResponses(p.Options))
+}
+
+func (h *PicklistHandler) CreateOption(c *gin.Context) {
+	list, ok := h.list(c)
+	if !ok {
+		return
+	}
+	var req dto.CreatePicklistOption
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	option := models.PicklistOption{
+		List:     list,
+		Value:    strings.TrimSpace(req.Value),
+		Position: req.Position,
+		Active:   true,
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&option).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "picklist_option", option.ID, nil, option)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "option already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, toPicklistOptionResponse(option))
+}
+
+// UpdateOption edits an option. Renaming also renames the value on every lead
+// so they keep pointing at a picklist entry.
+func (h *PicklistHandler) UpdateOption(c *gin.Context) {
+	option, ok := h.option(c)
+	if !ok {
+		return
+	}
+	var req dto.UpdatePicklistOption
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before := option
+
+	if req.Value != nil {
+		option.Value = strings.TrimSpace(*req.Value)
+	}
+	if req.Position != nil {
+		option.Position = *req.Position
+	}
+	if req.Active != nil {
+		option.Active = *req.Active
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&option).Error; err != nil {
+			return err
+		}
+		if option.Value != before.Value {
+			// option.List is one of picklist.Lists, which are lead columns.
+			if err := tx.Unscoped().Model(&models.Lead{}).Where(option.List+" = ?", before.Value).
+				Update(option.List, option.Value).Error; err != nil {
+				return err
+			}
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "picklist_option", option.ID, before, option)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "another option in the list has that value"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toPicklistOptionResponse(option))
+}
+
+// DeleteOption removes an unused option. Options still on leads must be
+// deactivated instead.
+func (h *PicklistHandler) DeleteOption(c *gin.Context) {
+	option, ok := h.option(c)
+	if !ok {
+		return
+	}
+
+	var inUse int64
+	// Deleted leads count too: they may be restored.
+	if err := h.db.Unscoped().Model(&models.Lead{}).Where(option.List+" = ?", option.Value).Count(&inUse).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%d leads use %q; deactivate it instead", inUse, option.Value)})
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&option).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "picklist_option", option.ID, option, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+func (h *PicklistHandler) list(c *gin.Context) (string, bool) {
+	list := c.Param("list")
+	if !picklist.Valid(list) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown picklist " + list})
+		return "", false
+	}
+	return list, true
+}
+
+func (h *PicklistHandler) option(c *gin.Context) (models.PicklistOption, bool) {
+	var option models.PicklistOption
+	list, ok := h.list(c)
+	if !ok {
+		return option, false
+	}
+	if err := h.db.First(&option, "id = ? AND list = ?", c.Param("option_id"), list).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "option not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return option, false
+	}
+	return option, true
+}
+
+func toPicklistOptionResponse(o models.PicklistOption) dto.PicklistOptionResponse {
+	return dto.PicklistOptionResponse{ID: o.ID, Value: o.Value, Position: o.Position, Active: o.Active}
+}
+
+func toPicklistOptionResponses(options []models.PicklistOption) []dto.PicklistOptionResponse {
+	out := make([]dto.PicklistOptionResponse, len(options))
+	for i, o := range options {
+		out[i] = toPicklistOptionResponse(o)
+	}
+	return out
+}
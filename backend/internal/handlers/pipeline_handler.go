@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+	"github.com/tim-contact/go-crm/internal/pipeline"
+)
+
+type PipelineHandler struct {
+	db *gorm.DB
+}
+
+func NewPipelineHandler(db *gorm.DB) *PipelineHandler {
+	return &PipelineHandler{db: db}
+}
+
+func (h *PipelineHandler) GetPipeline(c *gin.Context) {
+	out, err := h.pipelineResponse(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func (h *PipelineHandler) pipelineResponse(db *gorm.DB) (*dto.PipelineResponse, error) {
+	pl, err := pipeline.Load(db)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]string{}
+	out := &dto.PipelineResponse{
+		Statuses:    make([]dto.LeadStatusResponse, len(pl.Statuses)),
+		Transitions: []dto.StatusTransition{},
+	}
+	for i, s := range pl.Statuses {
+		names[s.ID] = s.Name
+		out.Statuses[i] = toLeadStatusResponse(s)
+	}
+
+	var transitions []models.LeadStatusTransition
+	if err := db.Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+	for _, t := range transitions {
+		out.Transitions = append(out.Transitions, dto.StatusTransition{From: names[t.FromStatusID], To: names[t.ToStatusID]})
+	}
+	return out, nil
+}
+
+func (h *PipelineHandler) CreateStatus(c *gin.Context) {
+	var req dto.CreateLeadStatus
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := models.LeadStatus{
+		Name:       strings.TrimSpace(req.Name),
+		Position:   req.Position,
+		IsInitial:  req.IsInitial,
+		IsTerminal: req.IsTerminal,
+		Color:      req.Color,
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if status.IsInitial {
+			if err := clearInitial(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&status).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "lead_status", status.ID, nil, status)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "status already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toLeadStatusResponse(status))
+}
+
+// UpdateStatus edits a status. Renaming also renames it on every lead so
+// leads.status keeps pointing at a pipeline entry.
+func (h *PipelineHandler) UpdateStatus(c *gin.Context) {
+	statusID := c.Param("status_id")
+
+	var req dto.UpdateLeadStatus
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var status models.LeadStatus
+	if err := h.db.First(&status, "id = ?", statusID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	before := status
+
+	if req.Name != nil {
+		status.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Position != nil {
+		status.Position = *req.Position
+	}
+	if req.IsInitial != nil {
+		status.IsInitial = *req.IsInitial
+	}
+	if req.IsTerminal != nil {
+		status.IsTerminal = *req.IsTerminal
+	}
+	if req.Color != nil {
+		status.Color = req.Color
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if status.IsInitial && !before.IsInitial {
+			if err := clearInitial(tx); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&status).Error; err != nil {
+			return err
+		}
+		if status.Name != before.Name {
+			if err := tx.Unscoped().Model(&models.Lead{}).Where("status = ?", before.Name).
+				Update("status", status.Name).Error; err != nil {
+				return err
+			}
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "lead_status", status.ID, before, status)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "another status has that name"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toLeadStatusResponse(status))
+}
+
+func (h *PipelineHandler) DeleteStatus(c *gin.Context) {
+	statusID := c.Param("status_id")
+
+	var status models.LeadStatus
+	if err := h.db.First(&status, "id = ?", statusID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "status not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	var inUse int64
+	// Deleted leads count too: they may be restored.
+	if err := h.db.Unscoped().Model(&models.Lead{}).Where("status = ?", status.Name).Count(&inUse).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if inUse > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%d leads are in status %q; move them first", inUse, status.Name)})
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&status).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "lead_status", status.ID, status, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+var errUnknownStatus = errors.New("unknown status")
+
+// ReplaceTransitions swaps the whole transition table for the given list.
+func (h *PipelineHandler) ReplaceTransitions(c *gin.Context) {
+	var req dto.ReplaceTransitions
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var out *dto.PipelineResponse
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		pl, err := pipeline.Load(tx)
+		if err != nil {
+			return err
+		}
+		before, err := h.pipelineResponse(tx)
+		if err != nil {
+			return err
+		}
+
+		rows := make([]models.LeadStatusTransition, 0, len(req.Transitions))
+		seen := map[[2]string]bool{}
+		for _, t := range req.Transitions {
+			from, ok := pl.Lookup(t.From)
+			if !ok {
+				return fmt.Errorf("%w %q", errUnknownStatus, t.From)
+			}
+			to, ok := pl.Lookup(t.To)
+			if !ok {
+				return fmt.Errorf("%w %q", errUnknownStatus, t.To)
+			}
+			key := [2]string{from.ID, to.ID}
+			if from.ID == to.ID || seen[key] {
+				continue
+			}
+			seen[key] = true
+			rows = append(rows, models.LeadStatusTransition{FromStatusID: from.ID, ToStatusID: to.ID})
+		}
+
+		if err := tx.Where("1 = 1").Delete(&models.LeadStatusTransition{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+
+		if out, err = h.pipelineResponse(tx); err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "lead_status_transitions", "",
+			gin.H{"transitions": before.Transitions}, gin.H{"transitions": out.Transitions})
+	})
+	if err != nil {
+		if errors.Is(err, errUnknownStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+type statusHistoryWithName struct {
+	models.LeadStatusHistory
+	ChangedByName *string `gorm:"column:changed_by_name"`
+}
+
+func (h *PipelineHandler) GetStatusHistory(c *gin.Context) {
+	leadID := c.Param("id")
+
+	var rows []statusHistoryWithName
+	if err := h.db.
+		Table("lead_status_history sh").
+		Select("sh.*, u.name AS changed_by_name").
+		Joins("LEFT JOIN users u ON u.id = sh.changed_by").
+		Where("sh.lead_id = ?", leadID).
+		Order("sh.changed_at DESC").
+		Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]dto.StatusHistoryResponse, len(rows))
+	for i, row := range rows {
+		response[i] = dto.StatusHistoryResponse{
+			ID:            row.ID,
+			LeadID:        row.LeadID,
+			FromStatus:    row.FromStatus,
+			ToStatus:      row.ToStatus,
+			ChangedBy:     row.ChangedBy,
+			ChangedByName: row.ChangedByName,
+			ChangedAt:     row.ChangedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, dto.StatusHistoryListResponse{History: response, TotalCount: len(response)})
+}
+
+func clearInitial(tx *gorm.DB) error {
+	return tx.Model(&models.LeadStatus{}).Where("is_initial").Update("is_initial", false).Error
+}
+
+func toLeadStatusResponse(s models.LeadStatus) dto.LeadStatusResponse {
+	return dto.LeadStatusResponse{
+		ID:         s.ID,
+		Name:       s.Name,
+		Position:   s.Position,
+		IsInitial:  s.IsInitial,
+		IsTerminal: s.IsTerminal,
+		Color:      s.Color,
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/leadtag"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+)
+
+type TagHandler struct {
+	db *gorm.DB
+}
+
+func NewTagHandler(db *gorm.DB) *TagHandler {
+	return &TagHandler{db: db}
+}
+
+func (h *TagHandler) ListTags(c *gin.Context) {
+	var tags []models.Tag
+	if err := h.db.Order("lower(name)").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toTagResponses(tags))
+}
+
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	var req dto.CreateTag
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tag := models.Tag{Name: strings.TrimSpace(req.Name), Color: req.Color}
+	if tag.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tag).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "tag", tag.ID, nil, tag)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "tag already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, toTagResponse(tag))
+}
+
+func (h *TagHandler) UpdateTag(c *gin.Context) {
+	tag, ok := h.tag(c, c.Param("tag_id"))
+	if !ok {
+		return
+	}
+	var req dto.UpdateTag
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before := tag
+
+	if req.Name != nil {
+		tag.Name = strings.TrimSpace(*req.Name)
+		if tag.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+	}
+	if req.Color != nil {
+		tag.Color = req.Color
+		if *req.Color == "" {
+			tag.Color = nil
+		}
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&tag).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUpdate, "tag", tag.ID, before, tag)
+	}); err != nil {
+		if pgerr.IsUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "another tag has that name"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toTagResponse(tag))
+}
+
+// DeleteTag removes the tag from every lead, then from the catalogue.
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	tag, ok := h.tag(c, c.Param("tag_id"))
+	if !ok {
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		var leadIDs []string
+		if err := tx.Model(&models.LeadTag{}).Where("tag_id = ?", tag.ID).Pluck("lead_id", &leadIDs).Error; err != nil {
+			return err
+		}
+		for _, id := range leadIDs {
+			if _, err := leadtag.Remove(tx, id, tag.ID, c.GetString("uid")); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(&tag).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "tag", tag.ID, tag, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *TagHandler) GetLeadTags(c *gin.Context) {
+	tags, err := leadtag.ForLead(h.db, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toTagResponses(tags))
+}
+
+// AddLeadTag tags the lead and returns its tags. Adding a tag the lead
+// already has is not an error.
+func (h *TagHandler) AddLeadTag(c *gin.Context) {
+	leadID := c.Param("id")
+	var req dto.AddLeadTag
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tag, ok := h.tag(c, req.TagID)
+	if !ok {
+		return
+	}
+
+	var tags []models.Tag
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		added, err := leadtag.Add(tx, leadID, tag.ID, c.GetString("uid"))
+		if err != nil {
+			return err
+		}
+		if added {
+			if err := audit.Record(tx, c, audit.ActionTag, "lead", leadID, nil, gin.H{"tag_id": tag.ID, "tag": tag.Name}); err != nil {
+				return err
+			}
+		}
+		tags, err = leadtag.ForLead(tx, leadID)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toTagResponses(tags))
+}
+
+func (h *TagHandler) RemoveLeadTag(c *gin.Context) {
+	leadID := c.Param("id")
+	tag, ok := h.tag(c, c.Param("tag_id"))
+	if !ok {
+		return
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		removed, err := leadtag.Remove(tx, leadID, tag.ID, c.GetString("uid"))
+		if err != nil || !removed {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionUntag, "lead", leadID, gin.H{"tag_id": tag.ID, "tag": tag.Name}, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *TagHandler) tag(c *gin.Context, id string) (models.Tag, bool) {
+	var tag models.Tag
+	if err := h.db.First(&tag, "id::text = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "tag not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return tag, false
+	}
+	return tag, true
+}
+
+func toTagResponse(t models.Tag) dto.TagResponse {
+	return dto.TagResponse{ID: t.ID, Name: t.Name, Color: t.Color}
+}
+
+func toTagResponses(tags []models.Tag) []dto.TagResponse {
+	out := make([]dto.TagResponse, len(tags))
+	for i, t := range tags {
+		out[i] = toTagResponse(t)
+	}
+	return out
+}
@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 
+	"github.com/tim-contact/go-crm/internal/audit"
 	"github.com/tim-contact/go-crm/internal/dto"
+	"github.com/tim-contact/go-crm/internal/etag"
 	"fmt"
 	"net/http"
 	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
 )
 
 
@@ -30,6 +37,11 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
+	if !canAssign(c, nil, req.AssignedTo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "assigning tasks to others requires task.reassign"})
+		return
+	}
+
 	task := models.Task{
 		LeadID:   leadID,
 		Title:    req.Title,
@@ -39,11 +51,17 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		AssignedTo: req.AssignedTo,
 	}
 
-	if err := h.db.Create(&task).Error; err != nil {
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionCreate, "task", task.ID, nil, task)
+	}); err != nil {
 		c.JSON(500, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.Header("ETag", etag.FromVersion(task.Version))
 	c.JSON(http.StatusCreated, task)
 
 
@@ -78,6 +96,7 @@ func (h *TaskHandler) GetTasks(c *gin.Context) {
 			AssignedTo: task.AssignedTo,
 			AssignedToName: task.AssignedToName,
 			CreatedAt:  task.CreatedAt,
+			Version:    task.Version,
 		}
 	}
 
@@ -110,11 +129,16 @@ func (h *TaskHandler) GetTodayTasks(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 		return
 	}
-	role, _ := c.Get("role")
+	viewer := scope.FromContext(c)
 
 	assignedTo := uid
-	if override := c.Query("assigned_to"); override != "" {
-		if roleStr, ok := role.(string); !ok || (roleStr != "admin" && roleStr != "coordinator") {
+	if override := c.Query("assigned_to"); override != "" && override != uid {
+		if !viewer.Can(permission.TaskQueueOthers) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+			return
+		}
+		// Without lead.read_all only users in the same branch.
+		if ok, err := viewer.CanSeeUser(h.db, override); err != nil || !ok {
 			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
 			return
 		}
@@ -141,7 +165,8 @@ func (h *TaskHandler) GetTodayTasks(c *gin.Context) {
 		Table("tasks t").
 		Select("t.*, u.name AS assigned_to_name").
 		Joins("LEFT JOIN users u ON u.id = t.assigned_to").
-		Where("t.assigned_to = ? AND t.status IN ?", assignedTo, []models.TaskStatus{models.TaskStatusOpen, models.TaskStatusInProgress})
+		Where("t.assigned_to = ? AND t.status IN ?", assignedTo, []models.TaskStatus{models.TaskStatusOpen, models.TaskStatusInProgress}).
+		Where("NOT EXISTS (SELECT 1 FROM leads dl WHERE dl.id = t.lead_id AND dl.deleted_at IS NOT NULL)")
 
 	var total int64
 	if err := base.Count(&total).Error; err != nil {
@@ -170,11 +195,10 @@ func (h *TaskHandler) GetTodayTasks(c *gin.Context) {
 			AssignedTo: task.AssignedTo,
 			AssignedToName: task.AssignedToName,
 			CreatedAt:  task.CreatedAt,
+			Version:    task.Version,
 		}
 	}
 
-	closedStatuses := []string{"done", "cancelled", "Closed"}
-
 	var followUpRows []followUpCallRow
 
 	followUpSQL := 
@@ -195,12 +219,13 @@ func (h *TaskHandler) GetTodayTasks(c *gin.Context) {
 			FROM leads l
 			LEFT JOIN last_fu lf ON lf.lead_id = l.id
 			WHERE l.allocated_user_id = ?
-			AND (l.status IS NULL OR l.status NOT IN ?)
+			AND l.deleted_at IS NULL
+			AND (l.status IS NULL OR l.status NOT IN (SELECT name FROM lead_statuses WHERE is_terminal))
 			AND (COALESCE(lf.last_fu_at, l.inquiry_date::timestamptz, l.created_at) + INTERVAL '3 days')::date <= CURRENT_DATE
 			ORDER BY due_at ASC
 			`
 
-	if err := h.db.Raw(followUpSQL, assignedTo, closedStatuses).Scan(&followUpRows).Error; err != nil {
+	if err := h.db.Raw(followUpSQL, assignedTo).Scan(&followUpRows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -252,7 +277,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 
 	var task models.Task
 
-	if err := h.db.First(&task, "id = ?", taskID).Error; err != nil {
+	if err := h.db.First(&task, "id = ? AND lead_id = ?", taskID, c.Param("id")).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		} else {
@@ -261,30 +286,54 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 
-	prevStatus := task.Status
-
-	if req.Title != nil {
-		task.Title = *req.Title
-	}
-	if req.DueDate != nil {
-		task.DueDate = req.DueDate
-	}
-	if req.Status != nil {
-		task.Status = models.TaskStatus(*req.Status)
-	}
-	if req.Kind != nil {
-		task.Kind = models.ActivityKind(*req.Kind)
-	}
-	if req.AssignedTo != nil {
-		task.AssignedTo = req.AssignedTo
+	if !canAssign(c, task.AssignedTo, req.AssignedTo) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "assigning tasks to others requires task.reassign"})
+		return
 	}
 
+	var before models.Task
 	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		// The row lock makes the If-Match check and the write atomic.
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&task, "id = ?", task.ID).Error; err != nil {
+			return err
+		}
+		if !etag.Matches(c.GetHeader("If-Match"), etag.FromVersion(task.Version)) {
+			return errTaskPreconditionFailed
+		}
+		before = task
+		prevStatus := task.Status
+
+		if req.Title != nil {
+			task.Title = *req.Title
+		}
+		if req.DueDate != nil {
+			task.DueDate = req.DueDate
+		}
+		if req.Status != nil {
+			task.Status = models.TaskStatus(*req.Status)
+		}
+		if req.Kind != nil {
+			task.Kind = models.ActivityKind(*req.Kind)
+		}
+		if req.AssignedTo != nil {
+			task.AssignedTo = req.AssignedTo
+		}
+		if prevStatus != models.TaskStatusDone && task.Status == models.TaskStatusDone {
+			now := time.Now()
+			task.CompletedAt, task.CompletedBy = &now, &uid
+		} else if task.Status != models.TaskStatusDone {
+			task.CompletedAt, task.CompletedBy = nil, nil
+		}
+		task.Version++
+
 		fmt.Printf("UpdateTask: saving task %s (prev=%s, next=%s, kind=%s)\n", task.ID, prevStatus, task.Status, task.Kind)
 		if err := tx.Save(&task).Error; err != nil {
 			fmt.Printf("UpdateTask: failed to save task %s: %v\n", task.ID, err)
 			return err
 		}
+		if err := audit.Record(tx, c, audit.ActionUpdate, "task", task.ID, before, task); err != nil {
+			return err
+		}
 		if prevStatus != models.TaskStatusDone && task.Status == models.TaskStatusDone {
 			fmt.Printf("UpdateTask: task %s transitioned to done, creating activity\n", task.ID)
 			summary := fmt.Sprintf("Task completed: %s", task.Title)
@@ -298,27 +347,25 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 				fmt.Printf("UpdateTask: failed to create activity for task %s: %v\n", task.ID, err)
 				return err
 			}
+			if err := audit.Record(tx, c, audit.ActionCreate, "activity", activity.ID, nil, activity); err != nil {
+				return err
+			}
 		} else {
 			fmt.Printf("UpdateTask: no activity created (prev=%s, next=%s)\n", prevStatus, task.Status)
 		}
 		return nil
 	}); err != nil {
+		if errors.Is(err, errTaskPreconditionFailed) {
+			c.Header("ETag", etag.FromVersion(task.Version))
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error(), "current": toTaskResponse(task)})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	out := dto.TaskResponse{
-		ID:         task.ID,
-		LeadID:     task.LeadID,
-		Title:      task.Title,
-		DueDate:    task.DueDate,
-		Kind:       string(task.Kind),
-		Status:     string(task.Status),
-		AssignedTo: task.AssignedTo,
-		CreatedAt:  task.CreatedAt,
-	}
-
-	c.JSON(http.StatusOK, out)
+	c.Header("ETag", etag.FromVersion(task.Version))
+	c.JSON(http.StatusOK, toTaskResponse(task))
 
 
 }
@@ -327,18 +374,68 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	taskID := c.Param("task_id")
 
-	result := h.db.Delete(&models.Task{}, "id = ?", taskID)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+	var task models.Task
+	if err := h.db.First(&task, "id = ? AND lead_id = ?", taskID, c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&task).Error; err != nil {
+			return err
+		}
+		return audit.Record(tx, c, audit.ActionDelete, "task", task.ID, task, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	
 	c.Status(http.StatusOK)	
 	
 }
+
+var errTaskPreconditionFailed = errors.New("the task was changed by someone else; reload and try again")
+
+func toTaskResponse(task models.Task) dto.TaskResponse {
+	return dto.TaskResponse{
+		ID:         task.ID,
+		LeadID:     task.LeadID,
+		Title:      task.Title,
+		DueDate:    task.DueDate,
+		Kind:       string(task.Kind),
+		Status:     string(task.Status),
+		AssignedTo: task.AssignedTo,
+		CreatedAt:  task.CreatedAt,
+		Version:    task.Version,
+	}
+}
+
+// canAssign reports whether the caller may change a task's assignee from
+// current to next. Leaving it alone, taking the task yourself or letting go
+// of your own task is always allowed; anything else, including unassigning
+// someone else, needs task.reassign.
+func canAssign(c *gin.Context, current, next *string) bool {
+	return canAssignTask(c.GetString("uid"), scope.FromContext(c).Can(permission.TaskReassign), current, next)
+}
+
+func canAssignTask(uid string, canReassign bool, current, next *string) bool {
+	if next == nil {
+		return true
+	}
+	from := ""
+	if current != nil {
+		from = *current
+	}
+	to := *next
+	switch {
+	case to == from, to == uid:
+		return true
+	case to == "" && from == uid:
+		return true
+	}
+	return canReassign
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import "testing"
+
+func TestCanAssignTask(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name        string
+		canReassign bool
+		current     *string
+		next        *string
+		want        bool
+	}{
+		{"assignee untouched", false, str("other"), nil, true},
+		{"same assignee", false, str("other"), str("other"), true},
+		{"take it yourself", false, str("other"), str("me"), true},
+		{"create unassigned", false, nil, str(""), true},
+		{"create for yourself", false, nil, str("me"), true},
+		{"create for someone else", false, nil, str("other"), false},
+		{"let go of your own task", false, str("me"), str(""), true},
+		{"unassign someone else", false, str("other"), str(""), false},
+		{"unassign someone else with task.reassign", true, str("other"), str(""), true},
+		{"hand to someone else", false, str("me"), str("other"), false},
+		{"hand to someone else with task.reassign", true, str("me"), str("other"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canAssignTask("me", tt.canReassign, tt.current, tt.next); got != tt.want {
+				t.Errorf("canAssignTask() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package inqid generates lead INQ IDs from a configurable pattern such as
+// {BRANCH}-{YYYY}-{SEQ:5}, numbering them per branch and year.
+package inqid
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// DefaultPattern gives IDs like COL-2025-00042.
+const DefaultPattern = "{BRANCH}-{YYYY}-{SEQ:5}"
+
+// NoBranchCode stands in for {BRANCH} on leads without a branch.
+const NoBranchCode = "GEN"
+
+// maxSkips bounds how many taken numbers Next steps over, e.g. when the
+// importer has already used IDs ahead of the counter.
+const maxSkips = 1000
+
+var tokenRE = regexp.MustCompile(`\{([A-Z]+)(?::(\d+))?\}`)
+
+// Pattern is a parsed ID pattern. Tokens are {BRANCH}, {YYYY}, {YY}, {MM}
+// and exactly one {SEQ} or {SEQ:width}; everything else is literal.
+type Pattern struct {
+	raw   string
+	width int
+}
+
+func Parse(raw string) (*Pattern, error) {
+	p := &Pattern{raw: raw}
+	seqs := 0
+	for _, m := range tokenRE.FindAllStringSubmatch(raw, -1) {
+		switch m[1] {
+		case "BRANCH", "YYYY", "YY", "MM":
+			if m[2] != "" {
+				return nil, fmt.Errorf("inq id pattern: {%s} takes no width", m[1])
+			}
+		case "SEQ":
+			seqs++
+			if m[2] != "" {
+				w, _ := strconv.Atoi(m[2])
+				if w < 1 || w > 12 {
+					return nil, fmt.Errorf("inq id pattern: SEQ width must be 1-12")
+				}
+				p.width = w
+			}
+		default:
+			return nil, fmt.Errorf("inq id pattern: unknown token {%s}", m[1])
+		}
+	}
+	if seqs != 1 {
+		return nil, fmt.Errorf("inq id pattern %q must contain exactly one {SEQ}", raw)
+	}
+	return p, nil
+}
+
+// scope renders everything but the sequence number. IDs sharing a scope share
+// a counter, so the numbering follows whatever the pattern distinguishes:
+// with {BRANCH} and {YYYY} it restarts per branch and year.
+func (p *Pattern) scope(branchCode string, at time.Time) string {
+	return tokenRE.ReplaceAllStringFunc(p.raw, func(tok string) string {
+		switch tokenRE.FindStringSubmatch(tok)[1] {
+		case "BRANCH":
+			return branchCode
+		case "YYYY":
+			return at.Format("2006")
+		case "YY":
+			return at.Format("06")
+		case "MM":
+			return at.Format("01")
+		}
+		return "{SEQ}"
+	})
+}
+
+// Format renders the ID with sequence number seq.
+func (p *Pattern) Format(branchCode string, at time.Time, seq int64) string {
+	return strings.Replace(p.scope(branchCode, at), "{SEQ}", p.pad(seq), 1)
+}
+
+func (p *Pattern) pad(seq int64) string {
+	return fmt.Sprintf("%0*d", p.width, seq)
+}
+
+var (
+	mu      sync.RWMutex
+	current = mustParse(DefaultPattern)
+)
+
+func mustParse(raw string) *Pattern {
+	p, err := Parse(raw)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Configure sets the pattern used by Next. Call it once at startup.
+func Configure(raw string) error {
+	p, err := Parse(raw)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current = p
+	mu.Unlock()
+	return nil
+}
+
+func pattern() *Pattern {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Sample renders an ID in the configured format without using up a number.
+func Sample(branchCode string, at time.Time, seq int64) string {
+	return pattern().Format(branchCode, at, seq)
+}
+
+// Next returns a new INQ ID for a lead in branchID dated at. It must run
+// inside the transaction that creates the lead: the counter row stays locked
+// until commit, so concurrent creates get consecutive numbers and a rollback
+// gives the number back.
+func Next(tx *gorm.DB, branchID *string, at time.Time) (string, error) {
+	p := pattern()
+	code, err := BranchCode(tx, branchID)
+	if err != nil {
+		return "", err
+	}
+	scope := p.scope(code, at)
+	if err := seed(tx, scope); err != nil {
+		return "", err
+	}
+
+	for i := 0; i < maxSkips; i++ {
+		var seq int64
+		if err := tx.Raw(`UPDATE inq_id_counters SET last_value = last_value + 1, updated_at = now()
+			WHERE scope = ? RETURNING last_value`, scope).Scan(&seq).Error; err != nil {
+			return "", err
+		}
+		id := strings.Replace(scope, "{SEQ}", p.pad(seq), 1)
+
+		var taken int64
+		if err := tx.Unscoped().Model(&models.Lead{}).Where("inq_id = ?", id).Count(&taken).Error; err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no free inq id in %s after %d tries", scope, maxSkips)
+}
+
+// seed creates the counter for scope on first use, starting after the
+// highest matching ID already in leads (e.g. from an earlier import).
+func seed(tx *gorm.DB, scope string) error {
+	var exists int64
+	if err := tx.Table("inq_id_counters").Where("scope = ?", scope).Count(&exists).Error; err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	prefix, suffix, _ := strings.Cut(scope, "{SEQ}")
+	var ids []string
+	if err := tx.Unscoped().Model(&models.Lead{}).
+		Where("inq_id LIKE ?", escapeLike(prefix)+"%"+escapeLike(suffix)).
+		Pluck("inq_id", &ids).Error; err != nil {
+		return err
+	}
+	var last int64
+	for _, id := range ids {
+		digits := strings.TrimSuffix(strings.TrimPrefix(id, prefix), suffix)
+		if !isDigits(digits) {
+			continue
+		}
+		if n, err := strconv.ParseInt(digits, 10, 64); err == nil && n > last {
+			last = n
+		}
+	}
+	return tx.Exec(`INSERT INTO inq_id_counters (scope, last_value) VALUES (?, ?)
+		ON CONFLICT (scope) DO NOTHING`, scope, last).Error
+}
+
+// BranchCode is the branch's code, or the first three letters/digits of its
+// name when no code is set.
+func BranchCode(tx *gorm.DB, branchID *string) (string, error) {
+	if branchID == nil || *branchID == "" {
+		return NoBranchCode, nil
+	}
+	var b models.Branch
+	if err := tx.Where("id = ?", *branchID).First(&b).Error; err != nil {
+		return "", err
+	}
+	if b.Code != nil && *b.Code != "" {
+		return *b.Code, nil
+	}
+	var code []rune
+	for _, r := range strings.ToUpper(b.Name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			code = append(code, r)
+		}
+		if len(code) == 3 {
+			break
+		}
+	}
+	if len(code) == 0 {
+		return NoBranchCode, nil
+	}
+	return string(code), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,91 @@
+package inqid
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{DefaultPattern, false},
+		{"INQ{SEQ}", false},
+		{"{BRANCH}/{YY}{MM}/{SEQ:1}", false},
+		{"{SEQ:12}", false},
+		{"", true},
+		{"{BRANCH}-{YYYY}", true},
+		{"{SEQ}-{SEQ}", true},
+		{"{SEQ:0}", true},
+		{"{SEQ:13}", true},
+		{"{YYYY:4}-{SEQ}", true},
+		{"{DD}-{SEQ}", true},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.pattern)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2025, time.March, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		pattern string
+		branch  string
+		seq     int64
+		want    string
+	}{
+		{DefaultPattern, "COL", 42, "COL-2025-00042"},
+		{DefaultPattern, "COL", 123456, "COL-2025-123456"},
+		{"INQ{SEQ}", "COL", 7, "INQ7"},
+		{"{BRANCH}{YY}{MM}-{SEQ:3}", "KAN", 1, "KAN2503-001"},
+		{"{SEQ:4}/{BRANCH}", NoBranchCode, 15, "0015/GEN"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.pattern, err)
+		}
+		if got := p.Format(tt.branch, at, tt.seq); got != tt.want {
+			t.Errorf("%q.Format(%q, %d) = %q, want %q", tt.pattern, tt.branch, tt.seq, got, tt.want)
+		}
+	}
+}
+
+// Numbering restarts wherever the rendered scope changes.
+func TestScopeRollover(t *testing.T) {
+	dec := time.Date(2024, time.December, 31, 23, 59, 0, 0, time.UTC)
+	jan := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		pattern   string
+		branchA   string
+		atA       time.Time
+		branchB   string
+		atB       time.Time
+		sameScope bool
+	}{
+		{"new year", DefaultPattern, "COL", dec, "COL", jan, false},
+		{"same year", DefaultPattern, "COL", jan, "COL", feb, true},
+		{"other branch", DefaultPattern, "COL", jan, "KAN", jan, false},
+		{"monthly pattern", "{BRANCH}{YY}{MM}-{SEQ}", "COL", jan, "COL", feb, false},
+		{"pattern without branch", "{YYYY}-{SEQ}", "COL", jan, "KAN", feb, true},
+		{"pattern without date", "{BRANCH}-{SEQ}", "COL", dec, "COL", jan, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a, b := p.scope(tt.branchA, tt.atA), p.scope(tt.branchB, tt.atB)
+			if (a == b) != tt.sameScope {
+				t.Errorf("scopes %q and %q: same = %v, want %v", a, b, a == b, tt.sameScope)
+			}
+		})
+	}
+}
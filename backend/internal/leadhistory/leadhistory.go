@@ -0,0 +1,126 @@
+// Package leadhistory records which lead fields were changed, from what, to
+// what and by whom.
+package leadhistory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// untracked fields are bookkeeping, derived from another field, or covered
+// elsewhere: status moves are in lead_status_history.
+var untracked = map[string]bool{
+	"id":                true,
+	"status":            true,
+	"whatsapp_no_e164":  true,
+	"allocation_reason": true,
+	"created_at":        true,
+	"updated_at":        true,
+	"deleted_at":        true,
+	"deleted_by":        true,
+}
+
+// Diff lists the fields that differ between before and after, in field
+// name order.
+func Diff(before, after models.Lead) ([]models.LeadFieldChange, error) {
+	old, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		if !untracked[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var changes []models.LeadFieldChange
+	for _, name := range names {
+		o, n := text(old[name]), text(cur[name])
+		if equal(o, n) {
+			continue
+		}
+		changes = append(changes, models.LeadFieldChange{
+			LeadID:   after.ID,
+			Field:    name,
+			OldValue: o,
+			NewValue: n,
+		})
+	}
+	return changes, nil
+}
+
+// Record stores the fields changed between before and after. actorID may be
+// empty for changes made by the system.
+func Record(tx *gorm.DB, before, after models.Lead, actorID string) error {
+	changes, err := Diff(before, after)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	if actorID != "" {
+		for i := range changes {
+			changes[i].ChangedBy = &actorID
+		}
+	}
+	return tx.Create(&changes).Error
+}
+
+// fields gives the lead's JSON fields, so names match what the API returns.
+func fields(l models.Lead) (map[string]any, error) {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func text(v any) *string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	return &s
+}
+
+func equal(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// RecordField stores a single change made without loading the whole lead,
+// such as a reassignment.
+func RecordField(tx *gorm.DB, leadID, field string, oldValue, newValue *string, actorID string) error {
+	if equal(oldValue, newValue) {
+		return nil
+	}
+	change := models.LeadFieldChange{LeadID: leadID, Field: field, OldValue: oldValue, NewValue: newValue}
+	if actorID != "" {
+		change.ChangedBy = &actorID
+	}
+	return tx.Create(&change).Error
+}
@@ -0,0 +1,82 @@
+package leadhistory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestDiff(t *testing.T) {
+	base := models.Lead{
+		ID:          "lead-1",
+		InqID:       "COL-2025-00001",
+		FullName:    "Asha Perera",
+		Team:        ptr("A"),
+		GPA:         ptr(float32(3.7)),
+		Age:         ptr(21),
+		Status:      ptr("New"),
+		InquiryDate: ptr(time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	type change struct{ field, old, new string }
+
+	tests := []struct {
+		name string
+		edit func(l *models.Lead)
+		want []change
+	}{
+		{"no change", func(l *models.Lead) {}, nil},
+		{"text field", func(l *models.Lead) { l.FullName = "Asha K. Perera" },
+			[]change{{"full_name", "Asha Perera", "Asha K. Perera"}}},
+		{"cleared field", func(l *models.Lead) { l.Team = nil },
+			[]change{{"team", "A", "<nil>"}}},
+		{"set field", func(l *models.Lead) { l.Remarks = ptr("call back") },
+			[]change{{"remarks", "<nil>", "call back"}}},
+		{"float keeps its digits", func(l *models.Lead) { l.GPA = ptr(float32(3.75)) },
+			[]change{{"gpa", "3.7", "3.75"}}},
+		{"integer", func(l *models.Lead) { l.Age = ptr(22) },
+			[]change{{"age", "21", "22"}}},
+		{"date", func(l *models.Lead) { l.InquiryDate = ptr(time.Date(2025, time.March, 2, 0, 0, 0, 0, time.UTC)) },
+			[]change{{"inquiry_date", "2025-03-01T00:00:00Z", "2025-03-02T00:00:00Z"}}},
+		{"untracked fields", func(l *models.Lead) {
+			l.Status = ptr("Contacted")
+			l.UpdatedAt = time.Now()
+			l.AllocationReason = ptr("Reassigned manually")
+			l.WhatsAppNoE164 = ptr("+94771234567")
+		}, nil},
+		{"sorted by field", func(l *models.Lead) {
+			l.Team = ptr("B")
+			l.FullName = "Asha K. Perera"
+		}, []change{{"full_name", "Asha Perera", "Asha K. Perera"}, {"team", "A", "B"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := base
+			tt.edit(&after)
+			got, err := Diff(base, after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Diff = %d changes %v, want %d", len(got), got, len(tt.want))
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.LeadID != base.ID || g.Field != w.field || deref(g.OldValue) != w.old || deref(g.NewValue) != w.new {
+					t.Errorf("change %d = %s %q -> %q, want %s %q -> %q",
+						i, g.Field, deref(g.OldValue), deref(g.NewValue), w.field, w.old, w.new)
+				}
+			}
+		})
+	}
+}
+
+// deref shows a nil value as <nil> so it can't be mistaken for "".
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
@@ -0,0 +1,291 @@
+// Package leadsheet reads and writes the legacy lead spreadsheet (CSV/XLSX)
+// using the Excel column mapping documented in 001_schema.sql.
+package leadsheet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// Column maps a spreadsheet header to the field it feeds. Fields are lead
+// columns except "branch" and "allocated_to", which are looked up by name.
+type Column struct {
+	Header string
+	Field  string
+}
+
+// Columns is the original Excel column order.
+var Columns = []Column{
+	{"DATE", "inquiry_date"},
+	{"INQ ID", "inq_id"},
+	{"STUDENT NAME", "full_name"},
+	{"GROUP NAME", "group_name"},
+	{"COUNTRY", "destination_country"},
+	{"BRANCH", "branch"},
+	{"FIELD", "field_of_study"},
+	{"AGE", "age"},
+	{"FLYING AS", "visa_category"},
+	{"PRINCIPLE", "principal"},
+	{"GPA", "gpa"},
+	{"WA NO", "whatsapp_no"},
+	{"TYPE", "lead_type"},
+	{"B TEAM", "team"},
+	{"STATUS", "status"},
+	{"METHOD", "contact_method"},
+	{"Allocated Person", "allocated_to"},
+	{"REMARKS", "remarks"},
+	{"CC (Sigma , Canda & KK)", "cc_specialist"},
+	{"CC (All countries)", "cc_all_countries"},
+	{"SPECIAL COMMENT", "special_comment"},
+}
+
+// Record is one data row keyed by Field. Line is the 1-based sheet row.
+type Record struct {
+	Line   int
+	Values map[string]string
+}
+
+func (r Record) Get(field string) string {
+	return r.Values[field]
+}
+
+var ErrUnsupportedFormat = errors.New("unsupported file format, expected .csv or .xlsx")
+
+func FormatFromFilename(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Read parses the first sheet of r. The header row may contain columns in any
+// order; unknown columns are ignored and blank rows are skipped.
+func Read(r io.Reader, format Format) ([]Record, error) {
+	var rows [][]string
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.TrimLeadingSpace = true
+		all, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		rows = all
+	case FormatXLSX:
+		f, err := excelize.OpenReader(r, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("open xlsx: %w", err)
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("xlsx has no sheets")
+		}
+		all, err := f.GetRows(sheets[0])
+		if err != nil {
+			return nil, fmt.Errorf("read xlsx: %w", err)
+		}
+		rows = all
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if len(rows) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	byKey := map[string]string{}
+	for _, col := range Columns {
+		byKey[headerKey(col.Header)] = col.Field
+	}
+	fields := make([]string, len(rows[0]))
+	found := 0
+	for i, h := range rows[0] {
+		if f, ok := byKey[headerKey(h)]; ok {
+			fields[i] = f
+			found++
+		}
+	}
+	if found == 0 {
+		return nil, errors.New("no recognised columns in header row")
+	}
+
+	var out []Record
+	for i, row := range rows[1:] {
+		rec := Record{Line: i + 2, Values: map[string]string{}}
+		for j, cell := range row {
+			if j >= len(fields) || fields[j] == "" {
+				continue
+			}
+			if v := unescapeCell(strings.TrimSpace(cell)); v != "" {
+				rec.Values[fields[j]] = v
+			}
+		}
+		if len(rec.Values) > 0 {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// headerKey squashes a header to upper-case letters and digits so that
+// "WA NO", "wa no" and "CC (Sigma, Canda & KK)" all match.
+func headerKey(h string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(h) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var dateLayouts = []string{
+	"2006-01-02",
+	"2/1/2006",
+	"02/01/2006",
+	"2006/01/02",
+	"2-Jan-2006",
+	"02-Jan-06",
+	time.RFC3339,
+}
+
+// ParseDate accepts ISO dates, day-first slashed dates as typed in the
+// legacy sheet, and Excel serial day numbers from raw XLSX cells.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if serial, err := strconv.ParseFloat(s, 64); err == nil && serial > 0 && serial < 100000 {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q", s)
+}
+
+func ContentType(format Format) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Writer streams records in Columns order, so exported files round-trip
+// through Read.
+type Writer struct {
+	format Format
+	out    io.Writer
+	csv    *csv.Writer
+	xlsx   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func NewWriter(w io.Writer, format Format) (*Writer, error) {
+	lw := &Writer{format: format, out: w}
+	header := make([]string, len(Columns))
+	for i, col := range Columns {
+		header[i] = col.Header
+	}
+
+	switch format {
+	case FormatCSV:
+		lw.csv = csv.NewWriter(w)
+		if err := lw.csv.Write(header); err != nil {
+			return nil, err
+		}
+	case FormatXLSX:
+		lw.xlsx = excelize.NewFile()
+		sw, err := lw.xlsx.NewStreamWriter("Sheet1")
+		if err != nil {
+			return nil, err
+		}
+		lw.stream = sw
+		if err := lw.writeXLSXRow(header); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	return lw, nil
+}
+
+func (w *Writer) Write(values map[string]string) error {
+	row := make([]string, len(Columns))
+	for i, col := range Columns {
+		row[i] = escapeCell(values[col.Field])
+	}
+	if w.format == FormatCSV {
+		return w.csv.Write(row)
+	}
+	return w.writeXLSXRow(row)
+}
+
+// formulaPrefixes make a spreadsheet treat a cell as a formula. Lead names
+// and remarks come from the public inquiry form, so they must never run.
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCell quotes a value that would otherwise be read as a formula.
+func escapeCell(v string) string {
+	if v != "" && strings.ContainsRune(formulaPrefixes, rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// unescapeCell undoes escapeCell so exported sheets re-import unchanged.
+func unescapeCell(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(v[1])) {
+		return v[1:]
+	}
+	return v
+}
+
+func (w *Writer) writeXLSXRow(row []string) error {
+	w.row++
+	cells := make([]interface{}, len(row))
+	for i, v := range row {
+		cells[i] = v
+	}
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.stream.SetRow(cell, cells)
+}
+
+// Close flushes buffered output. For XLSX the workbook is only written here.
+func (w *Writer) Close() error {
+	if w.format == FormatCSV {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	defer w.xlsx.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := w.xlsx.WriteTo(w.out)
+	return err
+}
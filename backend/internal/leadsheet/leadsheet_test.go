@@ -0,0 +1,95 @@
+package leadsheet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestEscapeCell(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Asha Perera", "Asha Perera"},
+		{"=HYPERLINK(\"http://evil\",\"x\")", "'=HYPERLINK(\"http://evil\",\"x\")"},
+		{"+94771234567", "'+94771234567"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=b", "a=b"},
+		{"'quoted", "'quoted"},
+	}
+	for _, tt := range tests {
+		if got := escapeCell(tt.in); got != tt.want {
+			t.Errorf("escapeCell(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if got := unescapeCell(escapeCell(tt.in)); got != tt.in {
+			t.Errorf("unescapeCell(escapeCell(%q)) = %q", tt.in, got)
+		}
+	}
+}
+
+const payload = `=HYPERLINK("http://evil.example","click")`
+
+func writeSheet(t *testing.T, format Format) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(map[string]string{"inq_id": "COL-2025-00001", "full_name": payload, "remarks": "@cmd", "whatsapp_no": "0771234567"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteEscapesFormulas(t *testing.T) {
+	for _, format := range []Format{FormatCSV, FormatXLSX} {
+		t.Run(string(format), func(t *testing.T) {
+			raw := writeSheet(t, format)
+
+			var cells []string
+			if format == FormatCSV {
+				rows, err := csv.NewReader(bytes.NewReader(raw)).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+				cells = rows[1]
+			} else {
+				f, err := excelize.OpenReader(bytes.NewReader(raw))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if formula, _ := f.GetCellFormula("Sheet1", "C2"); formula != "" {
+					t.Errorf("C2 is a formula: %q", formula)
+				}
+				rows, err := f.GetRows("Sheet1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				cells = rows[1]
+			}
+			if got := cells[2]; got != "'"+payload {
+				t.Errorf("STUDENT NAME cell = %q, want it quoted", got)
+			}
+
+			// Exports re-import with the original values.
+			recs, err := Read(bytes.NewReader(raw), format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recs) != 1 || recs[0].Get("full_name") != payload || recs[0].Get("remarks") != "@cmd" {
+				t.Errorf("Read = %+v", recs)
+			}
+		})
+	}
+}
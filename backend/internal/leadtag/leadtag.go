@@ -0,0 +1,114 @@
+// Package leadtag puts tags on leads and takes them off. Each change shows up
+// in the lead's field history as a change to "tags".
+package leadtag
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// Add tags the lead. It reports false if the lead already had the tag.
+func Add(tx *gorm.DB, leadID, tagID, actorID string) (bool, error) {
+	return change(tx, leadID, actorID, func() (int64, error) {
+		lt := models.LeadTag{LeadID: leadID, TagID: tagID}
+		if actorID != "" {
+			lt.CreatedBy = &actorID
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&lt)
+		return res.RowsAffected, res.Error
+	})
+}
+
+// Remove untags the lead. It reports false if the lead didn't have the tag.
+func Remove(tx *gorm.DB, leadID, tagID, actorID string) (bool, error) {
+	return change(tx, leadID, actorID, func() (int64, error) {
+		res := tx.Where("lead_id = ? AND tag_id = ?", leadID, tagID).Delete(&models.LeadTag{})
+		return res.RowsAffected, res.Error
+	})
+}
+
+// Move gives toLeadID every tag fromLeadID has, e.g. when merging
+// duplicates. It reports false if toLeadID already had them all.
+func Move(tx *gorm.DB, fromLeadID, toLeadID, actorID string) (bool, error) {
+	return change(tx, toLeadID, actorID, func() (int64, error) {
+		res := tx.Exec(`INSERT INTO lead_tags (lead_id, tag_id, created_by, created_at)
+			SELECT ?, tag_id, created_by, created_at FROM lead_tags WHERE lead_id = ?
+			ON CONFLICT DO NOTHING`, toLeadID, fromLeadID)
+		return res.RowsAffected, res.Error
+	})
+}
+
+// change runs apply and, if it changed anything, records the lead's tags
+// before and after and touches the lead so its ETag moves.
+func change(tx *gorm.DB, leadID, actorID string, apply func() (int64, error)) (bool, error) {
+	before, err := names(tx, leadID)
+	if err != nil {
+		return false, err
+	}
+	n, err := apply()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	after, err := names(tx, leadID)
+	if err != nil {
+		return false, err
+	}
+	if err := leadhistory.RecordField(tx, leadID, "tags", before, after, actorID); err != nil {
+		return false, err
+	}
+	return true, tx.Model(&models.Lead{}).Where("id = ?", leadID).Update("updated_at", time.Now()).Error
+}
+
+// names lists the lead's tags as "A, B", or nil without any.
+func names(tx *gorm.DB, leadID string) (*string, error) {
+	tags, err := ForLead(tx, leadID)
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	list := make([]string, len(tags))
+	for i, t := range tags {
+		list[i] = t.Name
+	}
+	s := strings.Join(list, ", ")
+	return &s, nil
+}
+
+// ForLead returns the lead's tags by name.
+func ForLead(db *gorm.DB, leadID string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := db.Joins("JOIN lead_tags lt ON lt.tag_id = tags.id").
+		Where("lt.lead_id = ?", leadID).
+		Order("lower(tags.name)").
+		Find(&tags).Error
+	return tags, err
+}
+
+// ForLeads returns the tags of each lead in leadIDs, keyed by lead ID.
+func ForLeads(db *gorm.DB, leadIDs []string) (map[string][]models.Tag, error) {
+	out := map[string][]models.Tag{}
+	if len(leadIDs) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		models.Tag
+		LeadID string
+	}
+	if err := db.Table("tags").
+		Select("tags.*, lt.lead_id").
+		Joins("JOIN lead_tags lt ON lt.tag_id = tags.id").
+		Where("lt.lead_id IN ?", leadIDs).
+		Order("lower(tags.name)").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.LeadID] = append(out[r.LeadID], r.Tag)
+	}
+	return out, nil
+}
@@ -0,0 +1,127 @@
+// Package mail sends transactional email (password resets, ...) through a
+// pluggable Sender so local development doesn't need an SMTP server.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tim-contact/go-crm/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromConfig picks the sender named by MAIL_DRIVER.
+func FromConfig(cfg config.Config) (Sender, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER=smtp requires SMTP_HOST")
+		}
+		return &SMTPSender{
+			Addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+			Host:     cfg.SMTPHost,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.MailFrom,
+		}, nil
+	case "file":
+		return &FileSender{Dir: cfg.MailFileDir, From: cfg.MailFrom}, nil
+	case "log", "":
+		// The log would hold live reset links.
+		if cfg.Production {
+			return nil, fmt.Errorf("MAIL_DRIVER must be smtp or file in production")
+		}
+		return LogSender{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q", cfg.MailDriver)
+}
+
+type SMTPSender struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(_ context.Context, msg Message) error {
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+	return smtp.SendMail(s.Addr, auth, envelopeAddress(s.From), []string{msg.To}, render(s.From, msg))
+}
+
+// FileSender writes each message as an .eml file, handy for inspecting
+// emails in local development.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+func (s *FileSender) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitize(msg.To))
+	path := filepath.Join(s.Dir, name)
+	if err := os.WriteFile(path, render(s.From, msg), 0o600); err != nil {
+		return err
+	}
+	log.Printf("mail: wrote %q for %s to %s", msg.Subject, msg.To, path)
+	return nil
+}
+
+// LogSender prints messages to the server log instead of sending them. It
+// is refused in production.
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, msg Message) error {
+	log.Printf("mail: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// envelopeAddress extracts "a@b" from "Name <a@b>".
+func envelopeAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(from[i+1:], ">")
+	}
+	return from
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(s))
+}
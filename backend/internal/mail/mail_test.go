@@ -0,0 +1,30 @@
+package mail
+
+import (
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/config"
+)
+
+func TestFromConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantErr bool
+	}{
+		{"log in development", config.Config{MailDriver: "log"}, false},
+		{"log refused in production", config.Config{Production: true, MailDriver: "log"}, true},
+		{"default refused in production", config.Config{Production: true}, true},
+		{"file in production", config.Config{Production: true, MailDriver: "file", MailFileDir: t.TempDir()}, false},
+		{"smtp needs a host", config.Config{MailDriver: "smtp"}, true},
+		{"unknown driver", config.Config{MailDriver: "pigeon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromConfig(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FromConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+type AllocationStrategy string
+
+const (
+	AllocationRoundRobin     AllocationStrategy = "round_robin"
+	AllocationLeastOpenTasks AllocationStrategy = "least_open_tasks"
+)
+
+type AllocationRule struct {
+	ID                 string             `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name               string             `gorm:"column:name;not null" json:"name"`
+	Priority           int                `gorm:"column:priority;not null;default:100" json:"priority"`
+	Active             bool               `gorm:"column:active;not null;default:true" json:"active"`
+	BranchID           *string            `gorm:"column:branch_id" json:"branch_id,omitempty"`
+	DestinationCountry *string            `gorm:"column:destination_country" json:"destination_country,omitempty"`
+	VisaCategory       *string            `gorm:"column:visa_category" json:"visa_category,omitempty"`
+	Strategy           AllocationStrategy `gorm:"column:strategy;type:text;not null;default:'round_robin'" json:"strategy"`
+	CreatedAt          time.Time          `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	UpdatedAt          time.Time          `gorm:"column:updated_at;not null;default:now()" json:"updated_at"`
+}
+
+func (AllocationRule) TableName() string {
+	return "allocation_rules"
+}
+
+type AllocationRuleMember struct {
+	RuleID         string     `gorm:"column:rule_id;primaryKey" json:"rule_id"`
+	UserID         string     `gorm:"column:user_id;primaryKey" json:"user_id"`
+	LastAssignedAt *time.Time `gorm:"column:last_assigned_at" json:"last_assigned_at,omitempty"`
+}
+
+func (AllocationRuleMember) TableName() string {
+	return "allocation_rule_members"
+}
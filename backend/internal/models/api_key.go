@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type APIKey struct {
+	ID         string         `gorm:"primaryKey" json:"id"`
+	Name       string         `gorm:"column:name;not null" json:"name"`
+	Prefix     string         `gorm:"column:prefix;uniqueIndex;not null" json:"prefix"`
+	KeyHash    string         `gorm:"column:key_hash;not null" json:"-"`
+	Scopes     pq.StringArray `gorm:"column:scopes;type:text[];not null" json:"scopes"`
+	UserID     string         `gorm:"column:user_id;not null;index" json:"user_id"`
+	CreatedBy  *string        `gorm:"column:created_by" json:"created_by,omitempty"`
+	ExpiresAt  *time.Time     `gorm:"column:expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time     `gorm:"column:last_used_at" json:"last_used_at,omitempty"`
+	LastUsedIP *string        `gorm:"column:last_used_ip" json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time     `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time      `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	ID      string  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ActorID *string `gorm:"column:actor_id" json:"actor_id,omitempty"`
+	// ImpersonatorID is the admin who acted as ActorID, if any.
+	ImpersonatorID *string         `gorm:"column:impersonator_id" json:"impersonator_id,omitempty"`
+	Action         string          `gorm:"column:action;not null" json:"action"`
+	Entity         string          `gorm:"column:entity;not null" json:"entity"`
+	EntityID       *string         `gorm:"column:entity_id" json:"entity_id,omitempty"`
+	Before         json.RawMessage `gorm:"column:before;type:jsonb" json:"before,omitempty"`
+	After          json.RawMessage `gorm:"column:after;type:jsonb" json:"after,omitempty"`
+	CreatedAt      time.Time       `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -4,6 +4,8 @@ package models
 type Branch struct {
 	ID   string `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	Name string `gorm:"column:name;uniqueIndex;not null" json:"name"`
+	// Code replaces {BRANCH} in generated INQ IDs.
+	Code *string `gorm:"column:code" json:"code"`
 }
 
 func (Branch) TableName() string { return "branches" }
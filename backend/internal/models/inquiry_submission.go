@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// InquirySubmission logs every POST to the public inquiry form, accepted or
+// not, so submissions can be rate limited per IP.
+type InquirySubmission struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	IP        string    `gorm:"column:ip;not null" json:"ip"`
+	UserAgent *string   `gorm:"column:user_agent" json:"user_agent,omitempty"`
+	Outcome   string    `gorm:"column:outcome;not null" json:"outcome"`
+	LeadID    *string   `gorm:"column:lead_id" json:"lead_id,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (InquirySubmission) TableName() string {
+	return "inquiry_submissions"
+}
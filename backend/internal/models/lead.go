@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Lead struct {
 	ID                 string     `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
@@ -16,12 +20,30 @@ type Lead struct {
 	Team	           *string    `gorm:"column:team" json:"team"`
 	Status             *string    `gorm:"column:status" json:"status"`
 	WhatsAppNo         string     `gorm:"column:whatsapp_no" json:"whatsapp_no"`
+	WhatsAppNoE164     *string    `gorm:"column:whatsapp_no_e164" json:"whatsapp_no_e164"`
 	InquiryDate        *time.Time `gorm:"column:inquiry_date" json:"inquiry_date"`
 	AllocatedUserID    *string    `gorm:"column:allocated_user_id" json:"allocated_user_id"`
+	AllocationReason   *string    `gorm:"column:allocation_reason" json:"allocation_reason"`
 	CreatedAt          time.Time  `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt          time.Time  `gorm:"column:updated_at" json:"updated_at"`
 	GroupName          *string     `gorm:"column:group_name" json:"group_name"`
 	Remarks            *string     `gorm:"column:remarks" json:"remarks"`
+	LeadType           *string    `gorm:"column:lead_type" json:"lead_type"`
+	ContactMethod      *string    `gorm:"column:contact_method" json:"contact_method"`
+	CCSpecialist       *string    `gorm:"column:cc_specialist" json:"cc_specialist"`
+	CCAllCountries     *string    `gorm:"column:cc_all_countries" json:"cc_all_countries"`
+	SpecialComment     *string    `gorm:"column:special_comment" json:"special_comment"`
+	// Soft delete: gorm leaves deleted leads out of model queries; raw
+	// queries on the leads table must filter deleted_at themselves.
+	DeletedAt          gorm.DeletedAt `gorm:"column:deleted_at;index" json:"deleted_at,omitempty"`
+	DeletedBy          *string    `gorm:"column:deleted_by" json:"deleted_by,omitempty"`
+	Source             *string    `gorm:"column:source" json:"source"`
+	UTMSource          *string    `gorm:"column:utm_source" json:"utm_source"`
+	UTMMedium          *string    `gorm:"column:utm_medium" json:"utm_medium"`
+	UTMCampaign        *string    `gorm:"column:utm_campaign" json:"utm_campaign"`
+	UTMTerm            *string    `gorm:"column:utm_term" json:"utm_term"`
+	UTMContent         *string    `gorm:"column:utm_content" json:"utm_content"`
+	Referrer           *string    `gorm:"column:referrer" json:"referrer"`
 }
 
 func (Lead) TableName() string {
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type LeadBulkJob struct {
+	ID         string          `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Operation  string          `gorm:"column:operation;not null" json:"operation"`
+	Value      *string         `gorm:"column:value" json:"value,omitempty"`
+	Status     string          `gorm:"column:status;not null;default:running" json:"status"`
+	Total      int             `gorm:"column:total;not null" json:"total"`
+	Processed  int             `gorm:"column:processed;not null;default:0" json:"processed"`
+	Succeeded  int             `gorm:"column:succeeded;not null;default:0" json:"succeeded"`
+	Failed     int             `gorm:"column:failed;not null;default:0" json:"failed"`
+	Results    json.RawMessage `gorm:"column:results;type:jsonb;not null;default:'[]'" json:"results"`
+	Error      *string         `gorm:"column:error" json:"error,omitempty"`
+	CreatedBy  *string         `gorm:"column:created_by" json:"created_by,omitempty"`
+	CreatedAt  time.Time       `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	FinishedAt *time.Time      `gorm:"column:finished_at" json:"finished_at,omitempty"`
+}
+
+func (LeadBulkJob) TableName() string {
+	return "lead_bulk_jobs"
+}
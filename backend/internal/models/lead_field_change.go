@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// LeadFieldChange is one column of a lead edited from OldValue to NewValue.
+// Values are stored as text; nil means the column was empty.
+type LeadFieldChange struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	LeadID    string    `gorm:"type:uuid;not null;index" json:"lead_id"`
+	Field     string    `gorm:"column:field;not null" json:"field"`
+	OldValue  *string   `gorm:"column:old_value" json:"old_value"`
+	NewValue  *string   `gorm:"column:new_value" json:"new_value"`
+	ChangedBy *string   `gorm:"column:changed_by" json:"changed_by,omitempty"`
+	ChangedAt time.Time `gorm:"column:changed_at;not null;default:now()" json:"changed_at"`
+}
+
+func (LeadFieldChange) TableName() string {
+	return "lead_field_changes"
+}
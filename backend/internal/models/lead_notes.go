@@ -7,7 +7,7 @@ type LeadNote struct {
 	LeadID    string     `gorm:"type:uuid;not null;index" json:"lead_id"`
 	Body      string     `gorm:"column:body" json:"body"`
 	CreatedBy string     `gorm:"column:created_by" json:"created_by"`
-	CreatedAt time.Time  `gorm:column:created_at" json:"created_at"`
+	CreatedAt time.Time  `gorm:"column:created_at" json:"created_at"`
 }
 
 func (LeadNote) TableName() string {
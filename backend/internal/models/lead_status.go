@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type LeadStatus struct {
+	ID         string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name       string    `gorm:"column:name;uniqueIndex;not null" json:"name"`
+	Position   int       `gorm:"column:position;not null;default:0" json:"position"`
+	IsInitial  bool      `gorm:"column:is_initial;not null;default:false" json:"is_initial"`
+	IsTerminal bool      `gorm:"column:is_terminal;not null;default:false" json:"is_terminal"`
+	Color      *string   `gorm:"column:color" json:"color,omitempty"`
+	CreatedAt  time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (LeadStatus) TableName() string {
+	return "lead_statuses"
+}
+
+type LeadStatusTransition struct {
+	FromStatusID string `gorm:"column:from_status_id;primaryKey" json:"from_status_id"`
+	ToStatusID   string `gorm:"column:to_status_id;primaryKey" json:"to_status_id"`
+}
+
+func (LeadStatusTransition) TableName() string {
+	return "lead_status_transitions"
+}
+
+type LeadStatusHistory struct {
+	ID         string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	LeadID     string    `gorm:"type:uuid;not null;index" json:"lead_id"`
+	FromStatus *string   `gorm:"column:from_status" json:"from_status,omitempty"`
+	ToStatus   string    `gorm:"column:to_status;not null" json:"to_status"`
+	ChangedBy  *string   `gorm:"column:changed_by" json:"changed_by,omitempty"`
+	ChangedAt  time.Time `gorm:"column:changed_at;not null;default:now()" json:"changed_at"`
+}
+
+func (LeadStatusHistory) TableName() string {
+	return "lead_status_history"
+}
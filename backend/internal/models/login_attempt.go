@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID    *string   `gorm:"column:user_id" json:"user_id,omitempty"`
+	Email     string    `gorm:"column:email;type:citext;not null" json:"email"`
+	IP        *string   `gorm:"column:ip" json:"ip,omitempty"`
+	UserAgent *string   `gorm:"column:user_agent" json:"user_agent,omitempty"`
+	Success   bool      `gorm:"column:success;not null" json:"success"`
+	Reason    *string   `gorm:"column:reason" json:"reason,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (LoginAttempt) TableName() string {
+	return "login_attempts"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type OIDCLogin struct {
+	ID            string     `gorm:"primaryKey" json:"id"`
+	StateHash     string     `gorm:"column:state_hash;uniqueIndex;not null" json:"-"`
+	Nonce         string     `gorm:"column:nonce;not null" json:"-"`
+	CodeVerifier  string     `gorm:"column:code_verifier;not null" json:"-"`
+	RedirectPath  *string    `gorm:"column:redirect_path" json:"redirect_path,omitempty"`
+	UserID        *string    `gorm:"column:user_id" json:"user_id,omitempty"`
+	LoginCodeHash *string    `gorm:"column:login_code_hash;uniqueIndex" json:"-"`
+	ExpiresAt     time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	ConsumedAt    *time.Time `gorm:"column:consumed_at" json:"consumed_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (OIDCLogin) TableName() string {
+	return "oidc_logins"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type PasswordResetToken struct {
+	ID          string     `gorm:"primaryKey" json:"id"`
+	UserID      string     `gorm:"column:user_id;not null;index" json:"user_id"`
+	TokenHash   string     `gorm:"column:token_hash;uniqueIndex;not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	UsedAt      *time.Time `gorm:"column:used_at" json:"used_at,omitempty"`
+	RequestedIP *string    `gorm:"column:requested_ip" json:"requested_ip,omitempty"`
+	CreatedAt   time.Time  `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
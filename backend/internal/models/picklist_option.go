@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PicklistOption is one allowed value of a managed lead field such as
+// contact_method. Inactive options stay valid on existing leads but can't be
+// chosen for new ones.
+type PicklistOption struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	List      string    `gorm:"column:list;not null" json:"list"`
+	Value     string    `gorm:"column:value;not null" json:"value"`
+	Position  int       `gorm:"column:position;not null;default:0" json:"position"`
+	Active    bool      `gorm:"column:active;not null;default:true" json:"active"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (PicklistOption) TableName() string {
+	return "picklist_options"
+}
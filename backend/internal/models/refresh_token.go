@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type RefreshToken struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"column:user_id;not null;index" json:"user_id"`
+	FamilyID   string     `gorm:"column:family_id;not null;index" json:"family_id"`
+	TokenHash  string     `gorm:"column:token_hash;uniqueIndex;not null" json:"-"`
+	ExpiresAt  time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	RevokedAt  *time.Time `gorm:"column:revoked_at" json:"revoked_at,omitempty"`
+	ReplacedBy *string    `gorm:"column:replaced_by" json:"replaced_by,omitempty"`
+	UserAgent  *string    `gorm:"column:user_agent" json:"user_agent,omitempty"`
+	IP         *string    `gorm:"column:ip" json:"ip,omitempty"`
+	CreatedAt  time.Time  `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
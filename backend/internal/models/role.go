@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type Role struct {
+	Name        string    `gorm:"primaryKey;column:name" json:"name"`
+	Description *string   `gorm:"column:description" json:"description"`
+	IsSystem    bool      `gorm:"column:is_system;not null;default:false" json:"is_system"`
+	CreatedAt   time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+type RolePermission struct {
+	Role       string `gorm:"primaryKey;column:role" json:"role"`
+	Permission string `gorm:"primaryKey;column:permission" json:"permission"`
+}
+
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
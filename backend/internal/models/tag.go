@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type Tag struct {
+	ID        string    `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name      string    `gorm:"column:name;not null" json:"name"`
+	Color     *string   `gorm:"column:color" json:"color,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+type LeadTag struct {
+	LeadID    string    `gorm:"column:lead_id;primaryKey" json:"lead_id"`
+	TagID     string    `gorm:"column:tag_id;primaryKey" json:"tag_id"`
+	CreatedBy *string   `gorm:"column:created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+}
+
+func (LeadTag) TableName() string {
+	return "lead_tags"
+}
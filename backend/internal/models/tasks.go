@@ -20,6 +20,10 @@ type Task struct {
 	Status        TaskStatus  `gorm:"column:status;type:text;not null;default:'open'" json:"status"`
 	AssignedTo    *string     `gorm:"column:assigned_to" json:"assigned_to,omitempty"`
 	CreatedAt     time.Time   `gorm:"column:created_at;not null;default:now()" json:"created_at"`
+	CompletedAt   *time.Time  `gorm:"column:completed_at" json:"completed_at,omitempty"`
+	CompletedBy   *string     `gorm:"column:completed_by" json:"completed_by,omitempty"`
+	// Version is bumped on every update and served as the task's ETag.
+	Version       int         `gorm:"column:version;not null;default:1" json:"version"`
 }
 
 func (Task) TableName() string {
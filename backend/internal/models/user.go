@@ -8,8 +8,19 @@ type User struct {
 	Email  string `gorm:"column:email;type:citext;uniqueIndex;not null" json:"email"`
 	Phone  *string `gorm:"column:phone;uniqueIndex" json:"phone"`
 	Role   string `gorm:"column:role;not null" json:"role"`
+	BranchID *string `gorm:"column:branch_id" json:"branch_id"`
+	Team   *string `gorm:"column:team" json:"team"`
 	PasswordHash string `gorm:"column:password_hash;not null" json:"-"`
 	Active bool   `gorm:"column:active;default:true" json:"active"`
+	TokenVersion int `gorm:"column:token_version;not null;default:0" json:"-"`
+	MFASecret *string `gorm:"column:mfa_secret" json:"-"`
+	MFAEnabled bool `gorm:"column:mfa_enabled;not null;default:false" json:"mfa_enabled"`
+	MFALastStep *int64 `gorm:"column:mfa_last_step" json:"-"`
+	FailedLoginCount int `gorm:"column:failed_login_count;not null;default:0" json:"-"`
+	LockedUntil *time.Time `gorm:"column:locked_until" json:"locked_until"`
+	OIDCIssuer *string `gorm:"column:oidc_issuer" json:"-"`
+	OIDCSubject *string `gorm:"column:oidc_subject" json:"-"`
+	LastLoginAt *time.Time `gorm:"column:last_login_at" json:"last_login_at"`
 	CreatedAt time.Time `gorm:"column:created_at" json:"created_at"`
 }
 
@@ -0,0 +1,200 @@
+// Package permission defines the named permissions routes are guarded by and
+// resolves a role to its permission set. Roles and their permissions live in
+// the roles / role_permissions tables; the names themselves are fixed here
+// because each one is checked somewhere in code.
+package permission
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	LeadRead       = "lead.read"
+	LeadReadBranch = "lead.read_branch"
+	LeadReadAll    = "lead.read_all"
+	LeadCreate     = "lead.create"
+	LeadUpdate     = "lead.update"
+	LeadDelete     = "lead.delete"
+	LeadImport     = "lead.import"
+	LeadExport     = "lead.export"
+	LeadMerge      = "lead.merge"
+	LeadTrash      = "lead.trash"
+	LeadBulk       = "lead.bulk"
+
+	NoteRead   = "note.read"
+	NoteWrite  = "note.write"
+	NoteDelete = "note.delete"
+
+	ActivityRead   = "activity.read"
+	ActivityWrite  = "activity.write"
+	ActivityDelete = "activity.delete"
+
+	TaskRead        = "task.read"
+	TaskWrite       = "task.write"
+	TaskDelete      = "task.delete"
+	TaskReassign    = "task.reassign"
+	TaskQueue       = "task.queue"
+	TaskQueueOthers = "task.queue_others"
+
+	UserList        = "user.list"
+	UserManage      = "user.manage"
+	UserImpersonate = "user.impersonate"
+	RoleManage      = "role.manage"
+
+	AuditRead        = "audit.read"
+	PipelineRead     = "pipeline.read"
+	PipelineManage   = "pipeline.manage"
+	PicklistManage   = "picklist.manage"
+	TagManage        = "tag.manage"
+	BranchManage     = "branch.manage"
+	AllocationManage = "allocation.manage"
+	APIKeyManage     = "apikey.manage"
+)
+
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Catalog lists every permission with a description for the role editor.
+var Catalog = []Definition{
+	{LeadRead, "List and view leads within the data scope"},
+	{LeadReadBranch, "Data scope: every lead in the user's branch"},
+	{LeadReadAll, "Data scope: every lead"},
+	{LeadCreate, "Create leads"},
+	{LeadUpdate, "Edit leads"},
+	{LeadDelete, "Delete leads"},
+	{LeadImport, "Import leads from CSV/XLSX"},
+	{LeadExport, "Export leads to CSV/XLSX"},
+	{LeadMerge, "Merge duplicate leads"},
+	{LeadTrash, "View and restore deleted leads"},
+	{LeadBulk, "Reassign, update or delete many leads at once"},
+	{NoteRead, "View lead notes"},
+	{NoteWrite, "Add and edit lead notes"},
+	{NoteDelete, "Delete lead notes"},
+	{ActivityRead, "View lead activities"},
+	{ActivityWrite, "Log and edit lead activities"},
+	{ActivityDelete, "Delete lead activities"},
+	{TaskRead, "View lead tasks"},
+	{TaskWrite, "Create and edit lead tasks"},
+	{TaskDelete, "Delete lead tasks"},
+	{TaskReassign, "Assign tasks to someone other than yourself"},
+	{TaskQueue, "Use the today/overdue task list"},
+	{TaskQueueOthers, "View another user's task list"},
+	{UserList, "See the staff directory"},
+	{UserManage, "Create, edit, deactivate and sign out users"},
+	{UserImpersonate, "Sign in as another user to see what they see"},
+	{RoleManage, "Create and edit roles"},
+	{AuditRead, "Read the audit log"},
+	{PipelineRead, "View lead statuses and transitions"},
+	{PipelineManage, "Edit lead statuses and transitions"},
+	{PicklistManage, "Edit the contact method and lead type options"},
+	{TagManage, "Create, rename, recolour and delete lead tags"},
+	{BranchManage, "Create branches and edit their names and INQ ID codes"},
+	{AllocationManage, "Edit lead allocation rules"},
+	{APIKeyManage, "Issue and revoke API keys"},
+}
+
+func Valid(name string) bool {
+	for _, d := range Catalog {
+		if d.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Set is a collection of permission names.
+type Set map[string]struct{}
+
+func NewSet(names ...string) Set {
+	s := Set{}
+	for _, n := range names {
+		s[n] = struct{}{}
+	}
+	return s
+}
+
+func (s Set) Has(name string) bool {
+	_, ok := s[name]
+	return ok
+}
+
+// Intersect returns the permissions present in both s and names.
+func (s Set) Intersect(names []string) Set {
+	out := Set{}
+	for _, n := range names {
+		if s.Has(n) {
+			out[n] = struct{}{}
+		}
+	}
+	return out
+}
+
+// Missing lists, sorted, the names that s doesn't have.
+func (s Set) Missing(names []string) []string {
+	var out []string
+	for _, n := range NewSet(names...).Names() {
+		if !s.Has(n) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (s Set) Names() []string {
+	out := make([]string, 0, len(s))
+	for n := range s {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Role permissions are read on every request, so they are cached briefly.
+// Writes through the role API call Invalidate; other instances pick changes
+// up within cacheTTL.
+const cacheTTL = 30 * time.Second
+
+var cache = struct {
+	sync.Mutex
+	loaded time.Time
+	roles  map[string]Set
+}{}
+
+// ForRole returns the permissions granted to role. Unknown roles have none.
+func ForRole(db *gorm.DB, role string) (Set, error) {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.roles == nil || time.Since(cache.loaded) > cacheTTL {
+		var rows []struct {
+			Role       string
+			Permission string
+		}
+		if err := db.Table("role_permissions").Select("role, permission").Scan(&rows).Error; err != nil {
+			return nil, err
+		}
+		roles := map[string]Set{}
+		for _, r := range rows {
+			if roles[r.Role] == nil {
+				roles[r.Role] = Set{}
+			}
+			roles[r.Role][r.Permission] = struct{}{}
+		}
+		cache.roles, cache.loaded = roles, time.Now()
+	}
+	if s, ok := cache.roles[role]; ok {
+		return s, nil
+	}
+	return Set{}, nil
+}
+
+func Invalidate() {
+	cache.Lock()
+	cache.roles = nil
+	cache.Unlock()
+}
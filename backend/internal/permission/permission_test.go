@@ -0,0 +1,30 @@
+package permission
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetMissing(t *testing.T) {
+	have := NewSet(LeadRead, LeadUpdate)
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+	}{
+		{"none asked", nil, nil},
+		{"all held", []string{LeadUpdate, LeadRead}, nil},
+		{"some missing, sorted", []string{UserManage, LeadRead, RoleManage}, []string{RoleManage, UserManage}},
+		{"duplicates once", []string{UserManage, UserManage}, []string{UserManage}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := have.Missing(tt.names); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Missing(%v) = %v, want %v", tt.names, got, tt.want)
+			}
+		})
+	}
+	if got := Set(nil).Missing([]string{LeadRead}); !reflect.DeepEqual(got, []string{LeadRead}) {
+		t.Errorf("nil set Missing = %v", got)
+	}
+}
@@ -0,0 +1,19 @@
+// Package pgerr recognises Postgres errors that handlers answer with
+// something other than a 500.
+package pgerr
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// UniqueViolation is SQLSTATE 23505.
+const UniqueViolation = "23505"
+
+// IsUniqueViolation reports whether err, or an error it wraps, is a unique
+// constraint violation.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == UniqueViolation
+}
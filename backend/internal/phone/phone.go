@@ -0,0 +1,57 @@
+// Package phone normalizes the WhatsApp numbers staff type in (usually local
+// Sri Lankan format such as 0771234567) to E.164.
+package phone
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// DefaultCountryCode is applied to numbers written in national format.
+var DefaultCountryCode = envOr("PHONE_DEFAULT_COUNTRY_CODE", "94")
+
+var ErrInvalidNumber = errors.New("invalid phone number")
+
+func envOr(k, def string) string {
+	if v := strings.TrimPrefix(strings.TrimSpace(os.Getenv(k)), "+"); v != "" {
+		return v
+	}
+	return def
+}
+
+// NormalizeE164 converts raw to +<country><number>. Accepted inputs are
+// "+94 77 123 4567", "0094771234567", "0771234567" and "771234567".
+func NormalizeE164(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	international := strings.HasPrefix(s, "+")
+
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.' || r == '+':
+		default:
+			return "", ErrInvalidNumber
+		}
+	}
+	d := digits.String()
+
+	switch {
+	case international:
+	case strings.HasPrefix(d, "00"):
+		d = d[2:]
+	case strings.HasPrefix(d, "0"):
+		d = DefaultCountryCode + d[1:]
+	case len(d) <= 10:
+		d = DefaultCountryCode + d
+	}
+
+	// E.164 allows at most 15 digits; anything under 8 cannot be a full
+	// subscriber number with country code.
+	if len(d) < 8 || len(d) > 15 || d[0] == '0' {
+		return "", ErrInvalidNumber
+	}
+	return "+" + d, nil
+}
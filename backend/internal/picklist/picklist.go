@@ -0,0 +1,100 @@
+// Package picklist loads the admin-managed option lists for lead fields such
+// as contact_method and lead_type.
+package picklist
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// Lists are the lead columns backed by a picklist. The list name is the
+// column name.
+const (
+	ContactMethod = "contact_method"
+	LeadType      = "lead_type"
+)
+
+var Lists = []string{ContactMethod, LeadType}
+
+func Valid(list string) bool {
+	for _, l := range Lists {
+		if l == list {
+			return true
+		}
+	}
+	return false
+}
+
+// ValueError reports a value that isn't an option of List, or whose option
+// has been deactivated.
+type ValueError struct {
+	List     string
+	Value    string
+	Inactive bool
+}
+
+func (e *ValueError) Error() string {
+	if e.Inactive {
+		return fmt.Sprintf("%s %q is no longer offered", e.List, e.Value)
+	}
+	return fmt.Sprintf("unknown %s %q", e.List, e.Value)
+}
+
+type Picklist struct {
+	List    string
+	Options []models.PicklistOption
+	byValue map[string]models.PicklistOption
+}
+
+func Load(db *gorm.DB, list string) (*Picklist, error) {
+	var options []models.PicklistOption
+	if err := db.Where("list = ?", list).Order("position ASC, value ASC").Find(&options).Error; err != nil {
+		return nil, err
+	}
+	p := &Picklist{List: list, Options: options, byValue: map[string]models.PicklistOption{}}
+	for _, o := range options {
+		p.byValue[strings.ToLower(o.Value)] = o
+	}
+	return p, nil
+}
+
+// Lookup finds an option case-insensitively so "whatsapp" is stored as
+// "WhatsApp".
+func (p *Picklist) Lookup(value string) (models.PicklistOption, bool) {
+	o, ok := p.byValue[strings.ToLower(strings.TrimSpace(value))]
+	return o, ok
+}
+
+// Resolve returns the canonical value to store. current is the lead's value
+// today; it stays allowed even after its option is deactivated.
+func (p *Picklist) Resolve(current *string, value string) (string, error) {
+	o, ok := p.Lookup(value)
+	if !ok {
+		return "", &ValueError{List: p.List, Value: value}
+	}
+	if !o.Active && (current == nil || !strings.EqualFold(*current, o.Value)) {
+		return "", &ValueError{List: p.List, Value: o.Value, Inactive: true}
+	}
+	return o.Value, nil
+}
+
+// Normalize resolves an optional request field. Both nil and a blank value
+// give nil, which stores NULL.
+func Normalize(db *gorm.DB, list string, current, value *string) (*string, error) {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil, nil
+	}
+	p, err := Load(db, list)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.Resolve(current, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -0,0 +1,121 @@
+// Package pipeline loads the admin-managed lead status pipeline and enforces
+// its transitions.
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+type Pipeline struct {
+	Statuses    []models.LeadStatus
+	byName      map[string]models.LeadStatus
+	transitions map[string]map[string]bool // status id -> allowed next ids
+}
+
+func Load(db *gorm.DB) (*Pipeline, error) {
+	var statuses []models.LeadStatus
+	if err := db.Order("position ASC, name ASC").Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	var transitions []models.LeadStatusTransition
+	if err := db.Find(&transitions).Error; err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{
+		Statuses:    statuses,
+		byName:      map[string]models.LeadStatus{},
+		transitions: map[string]map[string]bool{},
+	}
+	for _, s := range statuses {
+		p.byName[strings.ToLower(s.Name)] = s
+	}
+	for _, t := range transitions {
+		if p.transitions[t.FromStatusID] == nil {
+			p.transitions[t.FromStatusID] = map[string]bool{}
+		}
+		p.transitions[t.FromStatusID][t.ToStatusID] = true
+	}
+	return p, nil
+}
+
+// Lookup finds a status case-insensitively so "in progress" is stored as
+// "In Progress".
+func (p *Pipeline) Lookup(name string) (models.LeadStatus, bool) {
+	s, ok := p.byName[strings.ToLower(strings.TrimSpace(name))]
+	return s, ok
+}
+
+// Initial returns the status new leads start in, if one is configured.
+func (p *Pipeline) Initial() (models.LeadStatus, bool) {
+	for _, s := range p.Statuses {
+		if s.IsInitial {
+			return s, true
+		}
+	}
+	return models.LeadStatus{}, false
+}
+
+// Next returns the first status after from (Statuses are ordered by position)
+// that from may move to, used when a lead advances automatically.
+func (p *Pipeline) Next(from models.LeadStatus) (models.LeadStatus, bool) {
+	for _, s := range p.Statuses {
+		if s.Position > from.Position && p.transitions[from.ID][s.ID] {
+			return s, true
+		}
+	}
+	return models.LeadStatus{}, false
+}
+
+func (p *Pipeline) TerminalNames() []string {
+	var out []string
+	for _, s := range p.Statuses {
+		if s.IsTerminal {
+			out = append(out, s.Name)
+		}
+	}
+	return out
+}
+
+// Resolve validates a status change and returns the canonical name to store.
+// from is the lead's current status; an empty or unknown from (legacy data)
+// may move to any known status.
+func (p *Pipeline) Resolve(from *string, to string) (string, error) {
+	target, ok := p.Lookup(to)
+	if !ok {
+		return "", fmt.Errorf("unknown status %q", to)
+	}
+	if from == nil || *from == "" {
+		return target.Name, nil
+	}
+	current, ok := p.Lookup(*from)
+	if !ok || current.ID == target.ID {
+		return target.Name, nil
+	}
+	if !p.transitions[current.ID][target.ID] {
+		return "", fmt.Errorf("status cannot change from %q to %q", current.Name, target.Name)
+	}
+	return target.Name, nil
+}
+
+// RecordChange appends to lead_status_history. It is a no-op when the status
+// did not actually change.
+func RecordChange(tx *gorm.DB, leadID string, from *string, to string, actorID string) error {
+	if from != nil && *from == to {
+		return nil
+	}
+	h := models.LeadStatusHistory{
+		LeadID:     leadID,
+		FromStatus: from,
+		ToStatus:   to,
+	}
+	if actorID != "" {
+		h.ChangedBy = &actorID
+	}
+	return tx.Create(&h).Error
+}
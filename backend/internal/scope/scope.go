@@ -0,0 +1,93 @@
+// Package scope restricts queries to the rows the authenticated user may see:
+// lead.read_all sees every lead, lead.read_branch adds the user's branch, and
+// everyone sees leads allocated to them or that carry a task assigned to
+// them. Without a branch, lead.read_branch adds nothing.
+package scope
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/permission"
+)
+
+type Viewer struct {
+	UserID      string
+	Role        string
+	BranchID    string
+	Permissions permission.Set
+}
+
+// FromContext reads the identity Authn stored on the request.
+func FromContext(c *gin.Context) Viewer {
+	perms, _ := c.Get("permissions")
+	set, _ := perms.(permission.Set)
+	return Viewer{
+		UserID:      c.GetString("uid"),
+		Role:        c.GetString("role"),
+		BranchID:    c.GetString("branch_id"),
+		Permissions: set,
+	}
+}
+
+func (v Viewer) Can(perm string) bool {
+	return v.Permissions.Has(perm)
+}
+
+func (v Viewer) SeesAllLeads() bool {
+	return v.Can(permission.LeadReadAll)
+}
+
+func (v Viewer) seesBranch() bool {
+	return v.Can(permission.LeadReadBranch) && v.BranchID != ""
+}
+
+// Leads limits a query over the leads table (aliased as table) for use with
+// db.Scopes. Deleted leads are left out.
+func (v Viewer) Leads(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return v.visible(db.Where(table+".deleted_at IS NULL"), table)
+	}
+}
+
+// DeletedLeads is Leads for the trash: only deleted leads, same visibility.
+func (v Viewer) DeletedLeads(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return v.visible(db.Where(table+".deleted_at IS NOT NULL"), table)
+	}
+}
+
+func (v Viewer) visible(db *gorm.DB, table string) *gorm.DB {
+	if v.SeesAllLeads() {
+		return db
+	}
+	own := fmt.Sprintf("%[1]s.allocated_user_id = ? OR EXISTS (SELECT 1 FROM tasks st WHERE st.lead_id = %[1]s.id AND st.assigned_to = ?)", table)
+	if v.seesBranch() {
+		return db.Where(fmt.Sprintf("(%s.branch_id = ? OR %s)", table, own), v.BranchID, v.UserID, v.UserID)
+	}
+	return db.Where("("+own+")", v.UserID, v.UserID)
+}
+
+// CanSeeLead reports whether leadID exists and is visible.
+func (v Viewer) CanSeeLead(db *gorm.DB, leadID string) (bool, error) {
+	var n int64
+	err := db.Table("leads").Scopes(v.Leads("leads")).Where("leads.id = ?", leadID).Count(&n).Error
+	return n > 0, err
+}
+
+// CanSeeUser reports whether userID is within v's data scope, e.g. to view
+// their today list: anyone with lead.read_all, users in the same branch with
+// lead.read_branch.
+func (v Viewer) CanSeeUser(db *gorm.DB, userID string) (bool, error) {
+	if userID == v.UserID || v.SeesAllLeads() {
+		return true, nil
+	}
+	if !v.seesBranch() {
+		return false, nil
+	}
+	var n int64
+	err := db.Table("users").Where("id = ? AND branch_id = ?", userID, v.BranchID).Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/allocation"
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// allocateLead fills AllocatedUserID from the allocation rules when the
+// caller didn't choose someone. Leads no rule matches stay unallocated.
+func allocateLead(tx *gorm.DB, m *models.Lead) error {
+	if m.AllocatedUserID != nil && *m.AllocatedUserID != "" {
+		if m.AllocationReason == nil {
+			reason := "Allocated manually when the lead was created"
+			m.AllocationReason = &reason
+		}
+		return nil
+	}
+
+	res, err := allocation.Allocate(tx, allocation.Input{
+		BranchID:           m.BranchID,
+		DestinationCountry: m.DestinationCountry,
+		VisaCategory:       m.VisaCategory,
+	})
+	if err != nil || res == nil {
+		return err
+	}
+	m.AllocatedUserID = &res.UserID
+	m.AllocationReason = &res.Reason
+	return nil
+}
+
+// manualAllocationReason names whoever reassigned the lead. Their ID is on
+// the lead's field history and the audit log.
+func manualAllocationReason(db *gorm.DB, c *gin.Context) string {
+	var u models.User
+	if err := db.Select("name").First(&u, "id = ?", c.GetString("uid")).Error; err != nil || u.Name == "" {
+		return "Reassigned manually"
+	}
+	return "Reassigned manually by " + u.Name
+}
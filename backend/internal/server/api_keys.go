@@ -0,0 +1,184 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// Only record last use once a minute so busy integrations don't write on
+// every request.
+const apiKeyTouchInterval = time.Minute
+
+var errAPIKeyInvalid = errors.New("invalid api key")
+
+// verifyAPIKey resolves raw to a live key and the active user it acts as.
+func verifyAPIKey(db *gorm.DB, c *gin.Context, raw string) (*models.APIKey, *models.User, error) {
+	prefix, ok := auth.SplitAPIKey(raw)
+	if !ok {
+		return nil, nil, errAPIKeyInvalid
+	}
+	var key models.APIKey
+	if err := db.Where("prefix = ? AND revoked_at IS NULL", prefix).First(&key).Error; err != nil {
+		return nil, nil, errAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(auth.HashToken(raw))) != 1 {
+		return nil, nil, errAPIKeyInvalid
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, nil, errAPIKeyInvalid
+	}
+	var u models.User
+	if err := db.Select("id", "role", "active", "branch_id").
+		Where("id = ? AND active = TRUE", key.UserID).First(&u).Error; err != nil {
+		return nil, nil, errAPIKeyInvalid
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := db.Model(&models.APIKey{}).Where("id = ?", key.ID).Updates(map[string]any{
+			"last_used_at": time.Now(),
+			"last_used_ip": c.ClientIP(),
+		}).Error; err != nil {
+			log.Printf("api key %s: record use: %v", key.Prefix, err)
+		}
+	}
+	return &key, &u, nil
+}
+
+func listAPIKeys(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := db.Order("created_at DESC")
+		if c.Query("include_revoked") != "true" {
+			q = q.Where("revoked_at IS NULL")
+		}
+		var out []models.APIKey
+		if err := q.Find(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": out, "total": len(out)})
+	}
+}
+
+type apiKeyCreateReq struct {
+	Name      string     `json:"name" binding:"required,min=2"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"` // permission names
+	UserID    string     `json:"user_id"` // user the key acts as; defaults to the caller
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// createAPIKey issues a key. The full key is only ever returned here.
+func createAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req apiKeyCreateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		for _, s := range req.Scopes {
+			if !permission.Valid(s) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown permission " + s}); return
+			}
+		}
+		if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"}); return
+		}
+		uid := c.GetString("uid")
+		if req.UserID == "" {
+			req.UserID = uid
+		}
+		if err := checkAPIKeyGrant(scope.FromContext(c), req.UserID, req.Scopes); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()}); return
+		}
+		var owner models.User
+		if err := db.Where("id = ? AND active = TRUE", req.UserID).First(&owner).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user_id must be an active user"}); return
+		}
+		if owner.ID != uid {
+			ok, err := canAssignRole(db, c, owner.Role)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			if !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": "cannot issue a key for a user with permissions you don't have"}); return
+			}
+		}
+
+		raw, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate key"}); return
+		}
+		id, err := gonanoid.New(16)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate key"}); return
+		}
+		key := models.APIKey{
+			ID:        id,
+			Name:      req.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    req.Scopes,
+			UserID:    req.UserID,
+			CreatedBy: &uid,
+			ExpiresAt: req.ExpiresAt,
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&key).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionCreate, "api_key", key.ID, nil, key)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": raw})
+	}
+}
+
+// checkAPIKeyGrant keeps keys from outranking whoever issues them: scopes
+// must be permissions the caller holds, and a key for someone else needs
+// user management.
+func checkAPIKeyGrant(v scope.Viewer, userID string, scopes []string) error {
+	if missing := v.Permissions.Missing(scopes); len(missing) > 0 {
+		return fmt.Errorf("cannot grant scopes you don't hold: %s", strings.Join(missing, ", "))
+	}
+	if userID != v.UserID && !v.Can(permission.UserManage) {
+		return fmt.Errorf("only user managers can issue keys for other users")
+	}
+	return nil
+}
+
+func revokeAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("key_id")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return audit.Record(tx, c, "revoke", "api_key", id, nil, gin.H{"revoked": true})
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
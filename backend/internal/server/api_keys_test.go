@@ -0,0 +1,40 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+func TestCheckAPIKeyGrant(t *testing.T) {
+	integrator := scope.Viewer{
+		UserID:      "u1",
+		Permissions: permission.NewSet(permission.APIKeyManage, permission.LeadRead, permission.LeadCreate),
+	}
+	admin := scope.Viewer{
+		UserID:      "admin",
+		Permissions: permission.NewSet(permission.APIKeyManage, permission.UserManage, permission.LeadRead),
+	}
+	tests := []struct {
+		name    string
+		viewer  scope.Viewer
+		userID  string
+		scopes  []string
+		wantErr bool
+	}{
+		{"own key, held scopes", integrator, "u1", []string{permission.LeadRead, permission.LeadCreate}, false},
+		{"scope the caller lacks", integrator, "u1", []string{permission.LeadRead, permission.UserImpersonate}, true},
+		{"key for another user", integrator, "u2", []string{permission.LeadRead}, true},
+		{"user manager, another user", admin, "u2", []string{permission.LeadRead}, false},
+		{"user manager, scope they lack", admin, "u2", []string{permission.LeadDelete}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIKeyGrant(tt.viewer, tt.userID, tt.scopes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAPIKeyGrant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
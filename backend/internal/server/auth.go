@@ -1,8 +1,8 @@
 package server
 
 import (
+	"errors"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -10,6 +10,7 @@ import (
 
 	"github.com/tim-contact/go-crm/internal/models"
 	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/config"
 	gonanoid "github.com/matoous/go-nanoid/v2"
 )
 
@@ -18,7 +19,9 @@ type loginReq struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
-func login(db *gorm.DB) gin.HandlerFunc {
+// login checks the password. Users with MFA get a challenge token to
+// finish at /auth/mfa/verify instead of a session.
+func login(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
 	return func (c *gin.Context) {
 		var req loginReq
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -26,25 +29,117 @@ func login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if ipThrottled(db, c, req.Email) {
+			return
+		}
+
 		var u models.User
 		if err := db.Where("email = ? and active = true", req.Email).First(&u).Error; err != nil {
+			if wait := unknownEmailRetryAfter(db, req.Email); wait > 0 {
+				recordLoginAttempt(db, c, req.Email, nil, false, loginReasonLocked)
+				tooManyAttempts(c, wait)
+				return
+			}
+			loginFailed(db, c, req.Email, nil, loginReasonUnknownEmail)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"});
 			return
 		}
 
+		// Checked before the password so a locked account gives nothing away.
+		if wait := accountRetryAfter(u); wait > 0 {
+			recordLoginAttempt(db, c, req.Email, &u.ID, false, loginReasonLocked)
+			tooManyAttempts(c, wait)
+			return
+		}
+
 		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+			loginFailed(db, c, req.Email, &u, loginReasonBadPassword)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"});
 			return
 		}
 
-		token, err := auth.NewAccessToken(u.ID, u.Role, 60*time.Minute)
+		if challenge, ok, err := mfaChallenge(cfg, u); ok {
+			if err != nil {
+				c.JSON(500, gin.H{"error": "failed to generate token"});
+				return
+			}
+			c.JSON(http.StatusOK, challenge)
+			return
+		}
+
+		resp, err := completeLogin(db, c, u)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to generate token"});
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"access_token": token, "user": gin.H{
-			"id": u.ID, "name": u.Name, "email": u.Email, "role": u.Role,
-		},})
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// jwks publishes the public signing keys so other services can verify our
+// access tokens.
+func jwks(c *gin.Context) {
+	keys := []auth.JWK{}
+	if ks := auth.Keys(); ks != nil {
+		keys = append(keys, ks.JWKS()...)
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+type refreshReq struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func refresh(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+
+		pair, u, err := rotateRefreshToken(db, c, req.RefreshToken)
+		if err != nil {
+			if errors.Is(err, errRefreshInvalid) || errors.Is(err, errRefreshReused) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh session"}); return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in": pair.ExpiresIn,
+			"user": gin.H{
+				"id": u.ID, "name": u.Name, "email": u.Email, "role": u.Role,
+			},
+		})
+	}
+}
+
+// logout revokes the session family of the presented refresh token. The
+// access token itself simply expires.
+func logout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req refreshReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if err := revokeFamilyByHash(db, auth.HashToken(req.RefreshToken)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func revokeUserSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := revokeAllSessions(db, c.Param("id")); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
 	}
 }
 
@@ -52,7 +147,7 @@ type registerReq struct {
 	Name 	string 	`json:"name" binding:"required,min=2"`
 	Email 	string  `json:"email" binding:"required,email"`
 	Phone   string  `json:"phone"`
-	Role    string  `json:"role" binding:"required,oneof=admin coordinator agent viewer"`
+	Role    string  `json:"role" binding:"required"`
 	Password string `json:"password" binding:"required,min=8"`
 }
 
@@ -63,6 +158,15 @@ func register(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
 		}
 
+		if !roleExists(db, req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + req.Role}); return
+		}
+		if ok, err := canAssignRole(db, c, req.Role); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		} else if !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "cannot assign a role with permissions you don't have"}); return
+		}
+
 		id, err := gonanoid.New(10)
 		if err != nil {
 			c.JSON(500, gin.H{"error": "failed to generate user ID"}); return
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// Response headers set on every request made with an impersonation token so
+// the frontend can show a "viewing as" banner.
+const (
+	headerImpersonating = "X-Impersonating"
+	headerImpersonator  = "X-Impersonator"
+)
+
+// checkImpersonator re-validates the admin behind an impersonation token on
+// every request: deactivating them, revoking their sessions (a password
+// change does too) or taking away user.impersonate ends it.
+func checkImpersonator(db *gorm.DB, c *gin.Context, actorID string, actorTokenVersion int) bool {
+	var actor models.User
+	if err := db.Select("id", "role", "active", "token_version").Where("id = ? AND active = TRUE", actorID).First(&actor).Error; err != nil {
+		return false
+	}
+	if actor.TokenVersion != actorTokenVersion {
+		return false
+	}
+	perms, err := permission.ForRole(db, actor.Role)
+	if err != nil || !perms.Has(permission.UserImpersonate) {
+		return false
+	}
+	c.Set("impersonator_id", actorID)
+	c.Header(headerImpersonating, c.GetString("uid"))
+	c.Header(headerImpersonator, actorID)
+	return true
+}
+
+// impersonateUser mints a short-lived access token that acts as :id. Anything
+// done with it is audited under both the user and the admin.
+func impersonateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetString("uid")
+		id := c.Param("id")
+		if id == actorID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you can't impersonate yourself"}); return
+		}
+
+		var u models.User
+		if err := db.Where("id = ? AND active = TRUE", id).First(&u).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+		}
+		// No chains: an impersonator could otherwise borrow another
+		// admin's identity.
+		perms, err := permission.ForRole(db, u.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		if perms.Has(permission.UserImpersonate) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "users who can impersonate can't be impersonated"}); return
+		}
+
+		var actor models.User
+		if err := db.Select("id", "token_version").Where("id = ?", actorID).First(&actor).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		token, err := auth.NewImpersonationToken(u.ID, u.Role, u.TokenVersion, actorID, actor.TokenVersion)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate token"}); return
+		}
+		if err := audit.Record(db, c, "impersonate", "user", u.ID, nil, gin.H{"impersonated_by": actorID}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": token,
+			"expires_in": int(auth.ImpersonationTokenTTL.Seconds()),
+			"impersonating": gin.H{
+				"id": u.ID, "name": u.Name, "email": u.Email, "role": u.Role,
+			},
+		})
+	}
+}
+
+// getMe describes the current identity, including whether it is an admin
+// impersonating someone.
+func getMe(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out userDetail
+		if err := userDetailQuery(db).Where("users.id = ?", c.GetString("uid")).Scan(&out).Error; err != nil || out.ID == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+		}
+		resp := gin.H{
+			"user": out,
+			"permissions": scope.FromContext(c).Permissions.Names(),
+			"impersonated_by": nil,
+		}
+		if imp := c.GetString("impersonator_id"); imp != "" {
+			var actor models.User
+			if err := db.Select("id", "name", "email").Where("id = ?", imp).First(&actor).Error; err == nil {
+				resp["impersonated_by"] = gin.H{"id": actor.ID, "name": actor.Name, "email": actor.Email}
+			}
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/captcha"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/inqid"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pipeline"
+)
+
+// An IP may submit inquiryLimit forms within inquiryWindow. Rejected
+// submissions count too, so bots can't probe the captcha indefinitely.
+const (
+	inquiryLimit  = 5
+	inquiryWindow = time.Hour
+
+	inquirySource     = "web_form"
+	maxTrackingLength = 200
+)
+
+// Outcomes stored on inquiry_submissions. A submission is pending from the
+// moment it takes a rate limit slot until its outcome is known.
+const (
+	inquiryPending       = "pending"
+	inquiryAccepted      = "accepted"
+	inquiryInvalid       = "invalid"
+	inquiryHoneypot      = "honeypot"
+	inquiryCaptchaFailed = "captcha_failed"
+	inquiryFailed        = "failed"
+)
+
+// inquiryReq is the subset of leadCreateReq the public may set. Website is a
+// honeypot: the form hides it, so only bots fill it in.
+type inquiryReq struct {
+	FullName           string  `json:"full_name" binding:"required,min=2,max=200"`
+	DestinationCountry string  `json:"destination_country" binding:"required,min=2,max=100"`
+	Branch             string  `json:"branch" binding:"max=100"`
+	FieldOfStudy       *string `json:"field_of_study" binding:"omitempty,max=200"`
+	Age                *int    `json:"age" binding:"omitempty,gte=10,lte=100"`
+	VisaCategory       *string `json:"visa_category" binding:"omitempty,max=100"`
+	WhatsAppNo         string  `json:"whatsapp_no" binding:"required,len=10,numeric"`
+	Remarks            *string `json:"remarks" binding:"omitempty,max=2000"`
+
+	Source      *string `json:"source" binding:"omitempty,max=200"`
+	UTMSource   *string `json:"utm_source" binding:"omitempty,max=200"`
+	UTMMedium   *string `json:"utm_medium" binding:"omitempty,max=200"`
+	UTMCampaign *string `json:"utm_campaign" binding:"omitempty,max=200"`
+	UTMTerm     *string `json:"utm_term" binding:"omitempty,max=200"`
+	UTMContent  *string `json:"utm_content" binding:"omitempty,max=200"`
+
+	Website      string `json:"website"`
+	CaptchaToken string `json:"captcha_token"`
+}
+
+// createInquiry takes a lead from the public website. It runs without
+// authentication, so the lead gets the pipeline's initial status and is
+// allocated by the rules rather than trusting anything from the form.
+func createInquiry(db *gorm.DB, cfg config.Config, verifier captcha.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub, wait, err := reserveInquirySlot(db, c)
+		if err != nil {
+			log.Printf("inquiry: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit inquiry"})
+			return
+		}
+		if wait > 0 {
+			secs := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(secs))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many submissions, try again later", "retry_after": secs})
+			return
+		}
+
+		var req inquiryReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			setInquiryOutcome(db, sub, inquiryInvalid)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		branchID := inquiryBranchID(db, req.Branch, cfg.InquiryDefaultBranch)
+
+		// Bots get the same answer as people so they don't learn to skip it.
+		if req.Website != "" {
+			setInquiryOutcome(db, sub, inquiryHoneypot)
+			code, err := inqid.BranchCode(db, branchID)
+			if err != nil {
+				code = inqid.NoBranchCode
+			}
+			c.JSON(http.StatusCreated, gin.H{"inq_id": inqid.Sample(code, time.Now(), rand.Int64N(1000)+1)})
+			return
+		}
+
+		if err := verifier.Verify(c.Request.Context(), req.CaptchaToken, c.ClientIP()); err != nil {
+			if errors.Is(err, captcha.ErrFailed) {
+				setInquiryOutcome(db, sub, inquiryCaptchaFailed)
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("inquiry: %v", err)
+			setInquiryOutcome(db, sub, inquiryFailed)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "captcha verification unavailable"})
+			return
+		}
+
+		pl, err := pipeline.Load(db)
+		if err != nil {
+			setInquiryOutcome(db, sub, inquiryFailed)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		now := time.Now()
+		source := inquirySource
+		if req.Source != nil && *req.Source != "" {
+			source = *req.Source
+		}
+		m := models.Lead{
+			FullName:           strings.TrimSpace(req.FullName),
+			DestinationCountry: &req.DestinationCountry,
+			FieldOfStudy:       req.FieldOfStudy,
+			Age:                req.Age,
+			VisaCategory:       req.VisaCategory,
+			WhatsAppNo:         req.WhatsAppNo,
+			WhatsAppNoE164:     normalizeWhatsApp(req.WhatsAppNo),
+			Remarks:            req.Remarks,
+			InquiryDate:        &now,
+			BranchID:           branchID,
+			Source:             &source,
+			UTMSource:          utmParam(c, req.UTMSource, "utm_source"),
+			UTMMedium:          utmParam(c, req.UTMMedium, "utm_medium"),
+			UTMCampaign:        utmParam(c, req.UTMCampaign, "utm_campaign"),
+			UTMTerm:            utmParam(c, req.UTMTerm, "utm_term"),
+			UTMContent:         utmParam(c, req.UTMContent, "utm_content"),
+			Referrer:           truncated(c.Request.Referer()),
+		}
+		if initial, ok := pl.Initial(); ok {
+			m.Status = &initial.Name
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if m.InqID, err = nextInqID(tx, &m); err != nil {
+				return err
+			}
+			if err := allocateLead(tx, &m); err != nil {
+				return err
+			}
+			if err := tx.Create(&m).Error; err != nil {
+				return err
+			}
+			if m.Status != nil {
+				if err := pipeline.RecordChange(tx, m.ID, nil, *m.Status, ""); err != nil {
+					return err
+				}
+			}
+			if err := audit.Record(tx, c, audit.ActionCreate, "lead", m.ID, nil, m); err != nil {
+				return err
+			}
+			return tx.Model(&sub).Updates(map[string]any{"outcome": inquiryAccepted, "lead_id": m.ID}).Error
+		}); err != nil {
+			log.Printf("inquiry: create lead: %v", err)
+			setInquiryOutcome(db, sub, inquiryFailed)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit inquiry"})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"inq_id": m.InqID})
+	}
+}
+
+// reserveInquirySlot records a pending submission from the client's IP, or
+// reports how long the IP must wait if it has used up its submissions. The
+// count and the insert run under a per-IP lock so concurrent requests can't
+// both take the last slot.
+func reserveInquirySlot(db *gorm.DB, c *gin.Context) (models.InquirySubmission, time.Duration, error) {
+	sub := inquirySubmission(c, inquiryPending)
+	var wait time.Duration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "inquiry:"+sub.IP).Error; err != nil {
+			return err
+		}
+		var row struct {
+			Submissions int
+			First       *time.Time
+		}
+		if err := tx.Model(&models.InquirySubmission{}).
+			Select("COUNT(*) AS submissions, MIN(created_at) AS first").
+			Where("ip = ? AND created_at > ?", sub.IP, time.Now().Add(-inquiryWindow)).
+			Scan(&row).Error; err != nil {
+			return err
+		}
+		if row.Submissions >= inquiryLimit && row.First != nil {
+			if wait = time.Until(row.First.Add(inquiryWindow)); wait > 0 {
+				return nil
+			}
+		}
+		return tx.Create(&sub).Error
+	})
+	return sub, wait, err
+}
+
+// setInquiryOutcome settles a pending submission. The slot stays used either
+// way, so bots can't probe the captcha indefinitely.
+func setInquiryOutcome(db *gorm.DB, sub models.InquirySubmission, outcome string) {
+	if err := db.Model(&sub).Update("outcome", outcome).Error; err != nil {
+		log.Printf("inquiry: record submission from %s: %v", sub.IP, err)
+	}
+}
+
+func inquirySubmission(c *gin.Context, outcome string) models.InquirySubmission {
+	s := models.InquirySubmission{
+		IP:      c.ClientIP(),
+		Outcome: outcome,
+	}
+	if ua := c.Request.UserAgent(); ua != "" {
+		s.UserAgent = &ua
+	}
+	return s
+}
+
+// inquiryBranchID finds the named branch, falling back to the configured
+// default. Unlike staff-created leads, unknown names never create a branch.
+func inquiryBranchID(db *gorm.DB, names ...string) *string {
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var b models.Branch
+		if err := db.Where("lower(name) = lower(?)", name).First(&b).Error; err == nil {
+			return &b.ID
+		}
+	}
+	return nil
+}
+
+// utmParam prefers the value posted in the body and falls back to the query
+// string, since forms often post to the landing page URL as-is.
+func utmParam(c *gin.Context, body *string, key string) *string {
+	if body != nil && *body != "" {
+		return body
+	}
+	return truncated(c.Query(key))
+}
+
+func truncated(v string) *string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	if r := []rune(v); len(r) > maxTrackingLength {
+		v = string(r[:maxTrackingLength])
+	}
+	return &v
+}
@@ -0,0 +1,479 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/leadtag"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/pipeline"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// Bulk operations.
+const (
+	bulkReassign  = "reassign"
+	bulkSetStatus = "set_status"
+	bulkSetTeam   = "set_team"
+	bulkSetBranch = "set_branch"
+	bulkAddTag    = "add_tag"
+	bulkDelete    = "delete"
+)
+
+// Per-lead results.
+const (
+	bulkUpdated   = "updated"
+	bulkUnchanged = "unchanged"
+	bulkDeleted   = "deleted"
+	bulkNotFound  = "not_found"
+	bulkFailed    = "failed"
+)
+
+// Up to bulkSyncLimit leads are changed in one transaction during the
+// request. Larger sets, or any set with "background": true, run as a job in
+// transactions of bulkChunk leads.
+const (
+	bulkMaxLeads  = 10000
+	bulkSyncLimit = 200
+	bulkChunk     = 100
+)
+
+type bulkLeadReq struct {
+	Operation string  `json:"operation" binding:"required,oneof=reassign set_status set_team set_branch add_tag delete"`
+	Value     *string `json:"value"`
+	// Either IDs, or UseFilters to target every lead matching the listLeads
+	// filters in the query string.
+	IDs        []string `json:"ids" binding:"max=10000"`
+	UseFilters bool     `json:"use_filters"`
+	Background bool     `json:"background"`
+}
+
+type bulkResult struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// bulkOp is a validated operation, ready to apply lead by lead.
+type bulkOp struct {
+	name     string
+	value    *string
+	updates  map[string]any
+	pipeline *pipeline.Pipeline
+	tag      models.Tag
+}
+
+// bulkLeads applies one operation to many leads and reports the outcome for
+// each. A lead that can't be changed (say, a disallowed status move) is
+// reported as failed without holding up the rest.
+func bulkLeads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req bulkLeadReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		needed := permission.LeadUpdate
+		if req.Operation == bulkDelete {
+			needed = permission.LeadDelete
+		}
+		if !scope.FromContext(c).Permissions.Has(needed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forbidden", "missing_permission": needed})
+			return
+		}
+
+		op, err := prepareBulkOp(db, c, req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errBulkForbidden) {
+				status = http.StatusForbidden
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		ids, missing, err := bulkTargets(db, c, req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if !errors.Is(err, errBulkTarget) {
+				status = http.StatusInternalServerError
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		results := make([]bulkResult, 0, len(ids)+len(missing))
+		for _, id := range missing {
+			results = append(results, bulkResult{ID: id, Result: bulkNotFound})
+		}
+
+		if !req.Background && len(ids) <= bulkSyncLimit {
+			done, err := applyBulkChunk(db, c, op, ids)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			results = append(results, done...)
+			succeeded, failed := countBulkResults(results)
+			c.JSON(http.StatusOK, gin.H{
+				"operation": op.name,
+				"total":     len(results),
+				"succeeded": succeeded,
+				"failed":    failed,
+				"results":   results,
+			})
+			return
+		}
+
+		uid := c.GetString("uid")
+		job := models.LeadBulkJob{
+			Operation: op.name,
+			Value:     op.value,
+			Status:    "running",
+			Total:     len(ids) + len(missing),
+			CreatedBy: &uid,
+		}
+		if job.Results, err = json.Marshal(results); err == nil {
+			job.Processed = len(missing)
+			job.Failed = len(missing)
+			err = db.Create(&job).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// The request's context is recycled once the handler returns; the
+		// job keeps a copy for the actor and permissions.
+		go runBulkJob(db, c.Copy(), op, job.ID, ids)
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// getBulkJob reports a background job's progress. Only the user who started
+// it can see it.
+func getBulkJob(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var job models.LeadBulkJob
+		if err := db.Where("id::text = ? AND created_by = ?", c.Param("job_id"), c.GetString("uid")).
+			First(&job).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+var (
+	errBulkTarget    = errors.New("send either ids or use_filters")
+	errBulkForbidden = errors.New("forbidden")
+)
+
+// prepareBulkOp validates the value once so each lead only has to apply it.
+func prepareBulkOp(db *gorm.DB, c *gin.Context, req bulkLeadReq) (bulkOp, error) {
+	op := bulkOp{name: req.Operation}
+	value := ""
+	if req.Value != nil {
+		value = strings.TrimSpace(*req.Value)
+		op.value = &value
+	}
+
+	switch op.name {
+	case bulkReassign:
+		// A blank value unallocates the leads.
+		var userID *string
+		if value != "" {
+			var u models.User
+			if err := db.Where("id = ? AND active", value).First(&u).Error; err != nil {
+				return op, fmt.Errorf("no active user %q", value)
+			}
+			userID = &u.ID
+		}
+		op.updates = map[string]any{"allocated_user_id": userID, "allocation_reason": manualAllocationReason(db, c)}
+	case bulkSetStatus:
+		if value == "" {
+			return op, errors.New("value is required")
+		}
+		pl, err := pipeline.Load(db)
+		if err != nil {
+			return op, err
+		}
+		if _, ok := pl.Lookup(value); !ok {
+			return op, fmt.Errorf("unknown status %q", value)
+		}
+		op.pipeline = pl
+	case bulkSetTeam:
+		var team *string
+		if value != "" {
+			team = &value
+		}
+		op.updates = map[string]any{"team": team}
+	case bulkSetBranch:
+		if value == "" {
+			return op, errors.New("value is required")
+		}
+		// Unlike PUT /leads/:id, a mistyped name never creates a branch here.
+		var b models.Branch
+		if err := db.Where("lower(name) = lower(?)", value).First(&b).Error; err != nil {
+			return op, fmt.Errorf("unknown branch %q", value)
+		}
+		if !canMoveToBranch(scope.FromContext(c), b.ID) {
+			return op, fmt.Errorf("%w: leads can only be moved to your own branch", errBulkForbidden)
+		}
+		op.updates = map[string]any{"branch_id": b.ID}
+	case bulkAddTag:
+		if err := db.First(&op.tag, "id::text = ?", value).Error; err != nil {
+			return op, fmt.Errorf("unknown tag %q", value)
+		}
+	case bulkDelete:
+		op.value = nil
+	}
+	return op, nil
+}
+
+// bulkTargets resolves the request to lead IDs within the caller's data
+// scope. Explicit IDs the caller can't see come back as missing.
+func bulkTargets(db *gorm.DB, c *gin.Context, req bulkLeadReq) (ids, missing []string, err error) {
+	visible := db.Table("leads").Scopes(scope.FromContext(c).Leads("leads"))
+
+	switch {
+	case len(req.IDs) > 0 && !req.UseFilters:
+		var found []string
+		if err := visible.Where("leads.id::text IN ?", req.IDs).Pluck("leads.id", &found).Error; err != nil {
+			return nil, nil, err
+		}
+		ids, missing = splitVisible(req.IDs, found)
+		return ids, missing, nil
+
+	case len(req.IDs) == 0 && req.UseFilters:
+		var f leadFilters
+		if err := c.ShouldBindQuery(&f); err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid filters", errBulkTarget)
+		}
+		if err := leadsQuery(visible, f).Select("leads.id").
+			Order("leads.created_at ASC, leads.id ASC").Limit(bulkMaxLeads+1).
+			Pluck("leads.id", &ids).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(ids) > bulkMaxLeads {
+			return nil, nil, fmt.Errorf("%w: the filters match more than %d leads; narrow them", errBulkTarget, bulkMaxLeads)
+		}
+		return ids, nil, nil
+	}
+	return nil, nil, errBulkTarget
+}
+
+// splitVisible sorts the requested IDs, once each and in request order, into
+// those found in scope and the rest.
+func splitVisible(requested, found []string) (ids, missing []string) {
+	visible := map[string]bool{}
+	for _, id := range found {
+		visible[id] = true
+	}
+	seen := map[string]bool{}
+	for _, id := range requested {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if visible[id] {
+			ids = append(ids, id)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return ids, missing
+}
+
+// canMoveToBranch: moving leads into a branch the caller can't see would
+// hand them to another office.
+func canMoveToBranch(v scope.Viewer, branchID string) bool {
+	return v.SeesAllLeads() || v.BranchID == branchID
+}
+
+// runBulkJob works through ids in chunks, saving progress after each one.
+func runBulkJob(db *gorm.DB, c *gin.Context, op bulkOp, jobID string, ids []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			failBulkJob(db, jobID, fmt.Errorf("panic: %v", r))
+		}
+	}()
+	for start := 0; start < len(ids); start += bulkChunk {
+		end := min(start+bulkChunk, len(ids))
+		results, err := applyBulkChunk(db, c, op, ids[start:end])
+		if err == nil {
+			err = saveBulkProgress(db, jobID, results)
+		}
+		if err != nil {
+			failBulkJob(db, jobID, err)
+			return
+		}
+	}
+	if err := db.Model(&models.LeadBulkJob{}).Where("id = ?", jobID).Updates(map[string]any{
+		"status": "done", "finished_at": time.Now(),
+	}).Error; err != nil {
+		log.Printf("bulk job %s: %v", jobID, err)
+	}
+}
+
+func failBulkJob(db *gorm.DB, jobID string, cause error) {
+	log.Printf("bulk job %s: %v", jobID, cause)
+	if err := db.Model(&models.LeadBulkJob{}).Where("id = ?", jobID).Updates(map[string]any{
+		"status": "failed", "error": cause.Error(), "finished_at": time.Now(),
+	}).Error; err != nil {
+		log.Printf("bulk job %s: %v", jobID, err)
+	}
+}
+
+// FailInterruptedBulkJobs marks jobs left running by a previous process as
+// failed. Chunks already saved stay applied; the rest can be resubmitted.
+func FailInterruptedBulkJobs(db *gorm.DB) error {
+	res := db.Model(&models.LeadBulkJob{}).Where("status = ?", "running").Updates(map[string]any{
+		"status": "failed", "error": "interrupted by a server restart", "finished_at": time.Now(),
+	})
+	if res.RowsAffected > 0 {
+		log.Printf("marked %d interrupted bulk job(s) as failed", res.RowsAffected)
+	}
+	return res.Error
+}
+
+func saveBulkProgress(db *gorm.DB, jobID string, results []bulkResult) error {
+	raw, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	succeeded, failed := countBulkResults(results)
+	return db.Model(&models.LeadBulkJob{}).Where("id = ?", jobID).Updates(map[string]any{
+		"processed": gorm.Expr("processed + ?", len(results)),
+		"succeeded": gorm.Expr("succeeded + ?", succeeded),
+		"failed":    gorm.Expr("failed + ?", failed),
+		"results":   gorm.Expr("results || ?::jsonb", string(raw)),
+	}).Error
+}
+
+// applyBulkChunk changes ids in one transaction, with a savepoint per lead
+// so one failure doesn't undo the others.
+func applyBulkChunk(db *gorm.DB, c *gin.Context, op bulkOp, ids []string) ([]bulkResult, error) {
+	results := make([]bulkResult, 0, len(ids))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			sp := fmt.Sprintf("bulk_lead_%d", i)
+			if err := tx.SavePoint(sp).Error; err != nil {
+				return err
+			}
+			result, err := applyBulkOp(tx, c, op, id)
+			if err != nil {
+				if err := tx.RollbackTo(sp).Error; err != nil {
+					return err
+				}
+				results = append(results, bulkResult{ID: id, Result: bulkFailed, Error: err.Error()})
+				continue
+			}
+			results = append(results, bulkResult{ID: id, Result: result})
+		}
+		return nil
+	})
+	return results, err
+}
+
+func applyBulkOp(tx *gorm.DB, c *gin.Context, op bulkOp, id string) (string, error) {
+	uid := c.GetString("uid")
+	var before models.Lead
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return bulkNotFound, nil
+		}
+		return "", err
+	}
+
+	if op.name == bulkDelete {
+		if err := tx.Model(&models.Lead{}).Where("id = ?", id).Updates(map[string]any{
+			"deleted_at": time.Now(),
+			"deleted_by": uid,
+		}).Error; err != nil {
+			return "", err
+		}
+		return bulkDeleted, audit.Record(tx, c, audit.ActionDelete, "lead", id, before, nil)
+	}
+	if op.name == bulkAddTag {
+		added, err := leadtag.Add(tx, id, op.tag.ID, uid)
+		if err != nil || !added {
+			return bulkUnchanged, err
+		}
+		return bulkUpdated, audit.Record(tx, c, audit.ActionTag, "lead", id, nil, gin.H{"tag_id": op.tag.ID, "tag": op.tag.Name})
+	}
+
+	updates := op.updates
+	switch op.name {
+	case bulkReassign:
+		if sameString(before.AllocatedUserID, updates["allocated_user_id"].(*string)) {
+			return bulkUnchanged, nil
+		}
+	case bulkSetStatus:
+		name, err := op.pipeline.Resolve(before.Status, *op.value)
+		if err != nil {
+			return "", err
+		}
+		if before.Status != nil && *before.Status == name {
+			return bulkUnchanged, nil
+		}
+		updates = map[string]any{"status": name}
+	case bulkSetTeam:
+		if sameString(before.Team, updates["team"].(*string)) {
+			return bulkUnchanged, nil
+		}
+	case bulkSetBranch:
+		if before.BranchID != nil && *before.BranchID == updates["branch_id"] {
+			return bulkUnchanged, nil
+		}
+	}
+
+	if err := tx.Model(&models.Lead{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return "", err
+	}
+	var after models.Lead
+	if err := tx.First(&after, "id = ?", id).Error; err != nil {
+		return "", err
+	}
+	if op.name == bulkSetStatus {
+		if err := pipeline.RecordChange(tx, id, before.Status, *after.Status, uid); err != nil {
+			return "", err
+		}
+	}
+	if err := leadhistory.Record(tx, before, after, uid); err != nil {
+		return "", err
+	}
+	return bulkUpdated, audit.Record(tx, c, audit.ActionUpdate, "lead", id, before, after)
+}
+
+func countBulkResults(results []bulkResult) (succeeded, failed int) {
+	for _, r := range results {
+		switch r.Result {
+		case bulkNotFound, bulkFailed:
+			failed++
+		default:
+			succeeded++
+		}
+	}
+	return succeeded, failed
+}
+
+func sameString(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
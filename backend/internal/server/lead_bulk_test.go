@@ -0,0 +1,57 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+func TestSplitVisible(t *testing.T) {
+	tests := []struct {
+		name        string
+		requested   []string
+		found       []string
+		wantIDs     []string
+		wantMissing []string
+	}{
+		{"all visible", []string{"a", "b"}, []string{"b", "a"}, []string{"a", "b"}, nil},
+		{"out of scope is missing", []string{"a", "x", "b"}, []string{"a", "b"}, []string{"a", "b"}, []string{"x"}},
+		{"nothing visible", []string{"x", "y"}, nil, nil, []string{"x", "y"}},
+		{"duplicates once", []string{"a", "x", "a", "x"}, []string{"a"}, []string{"a"}, []string{"x"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, missing := splitVisible(tt.requested, tt.found)
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("splitVisible() = %v, %v; want %v, %v", ids, missing, tt.wantIDs, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestCanMoveToBranch(t *testing.T) {
+	all := scope.Viewer{UserID: "u1", Permissions: permission.NewSet(permission.LeadReadAll)}
+	branch := scope.Viewer{UserID: "u1", BranchID: "b1", Permissions: permission.NewSet(permission.LeadReadBranch)}
+	noBranch := scope.Viewer{UserID: "u1", Permissions: permission.NewSet(permission.LeadRead)}
+
+	tests := []struct {
+		name   string
+		viewer scope.Viewer
+		target string
+		want   bool
+	}{
+		{"read_all anywhere", all, "b2", true},
+		{"own branch", branch, "b1", true},
+		{"other branch", branch, "b2", false},
+		{"no branch", noBranch, "b1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canMoveToBranch(tt.viewer, tt.target); got != tt.want {
+				t.Errorf("canMoveToBranch(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/leadtag"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/phone"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// Trigram similarity above which two full names are treated as the same
+// student. pg_trgm's own default (0.3) is far too loose for names.
+const duplicateNameSimilarity = 0.7
+
+type duplicateCandidate struct {
+	ID                string  `json:"id"`
+	InqID             string  `json:"inq_id"`
+	FullName          string  `json:"full_name"`
+	WhatsAppNo        string  `gorm:"column:whatsapp_no" json:"whatsapp_no"`
+	BranchName        string  `json:"branch_name"`
+	AllocatedUserName string  `json:"allocated_user_name"`
+	SameWhatsApp      bool    `gorm:"column:same_whatsapp" json:"same_whatsapp"`
+	NameSimilarity    float64 `json:"name_similarity"`
+}
+
+// findDuplicateLeads returns existing leads with the same normalized WhatsApp
+// number or a near-identical full name. excludeID skips the lead itself.
+func findDuplicateLeads(db *gorm.DB, fullName string, e164 *string, excludeID string) ([]duplicateCandidate, error) {
+	number := ""
+	if e164 != nil {
+		number = *e164
+	}
+
+	q := db.Table("leads").Where("leads.deleted_at IS NULL")
+	if excludeID != "" {
+		q = q.Where("leads.id <> ?", excludeID)
+	}
+
+	// "%" uses the trigram index with pg_trgm's loose default threshold; the
+	// similarity() check then applies ours.
+	var out []duplicateCandidate
+	err := q.
+		Select(`leads.id, leads.inq_id, leads.full_name, leads.whatsapp_no,
+			COALESCE(branches.name, '') AS branch_name,
+			COALESCE(u.name, '') AS allocated_user_name,
+			(leads.whatsapp_no_e164 IS NOT NULL AND leads.whatsapp_no_e164 = ?) AS same_whatsapp,
+			similarity(leads.full_name, ?) AS name_similarity`, number, fullName).
+		Joins("LEFT JOIN branches ON branches.id = leads.branch_id").
+		Joins("LEFT JOIN users u ON u.id = leads.allocated_user_id").
+		Where("((? <> '' AND leads.whatsapp_no_e164 = ?) OR (leads.full_name % ? AND similarity(leads.full_name, ?) >= ?))",
+			number, number, fullName, fullName, duplicateNameSimilarity).
+		Order("same_whatsapp DESC, name_similarity DESC").
+		Limit(10).
+		Scan(&out).Error
+	return out, err
+}
+
+// normalizeWhatsApp returns the E.164 form of raw, or nil when raw is empty or
+// cannot be normalized; the raw value is always kept as typed.
+func normalizeWhatsApp(raw string) *string {
+	if raw == "" {
+		return nil
+	}
+	e164, err := phone.NormalizeE164(raw)
+	if err != nil {
+		return nil
+	}
+	return &e164
+}
+
+type leadMergeReq struct {
+	SourceID string `json:"source_id" binding:"required"`
+}
+
+// mergeColumns are copied from the merged lead onto the survivor when the
+// survivor has no value of its own.
+var mergeColumns = []string{
+	"group_name", "destination_country", "field_of_study", "age", "visa_category",
+	"principal", "gpa", "team", "inquiry_date", "allocated_user_id", "remarks",
+	"whatsapp_no_e164", "lead_type", "contact_method", "cc_specialist",
+	"cc_all_countries", "special_comment",
+}
+
+// mergeLeads folds source_id into :id. Notes, activities and tasks move to the
+// survivor, its empty fields are filled from the duplicate, and the duplicate
+// is deleted. The merge is recorded in the audit log and as a lead note.
+func mergeLeads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		targetID := c.Param("id")
+		var req leadMergeReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if req.SourceID == targetID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot merge a lead into itself"}); return
+		}
+
+		var target models.Lead
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var source models.Lead
+			locked := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+			if err := locked.First(&target, "id = ?", targetID).Error; err != nil {
+				return err
+			}
+			if err := locked.First(&source, "id = ?", req.SourceID).Error; err != nil {
+				return err
+			}
+			if ok, err := scope.FromContext(c).CanSeeLead(tx, source.ID); err != nil || !ok {
+				return gorm.ErrRecordNotFound
+			}
+			before := target
+
+			for _, table := range []string{"lead_notes", "activities"} {
+				if err := tx.Table(table).Where("lead_id = ?", source.ID).
+					Update("lead_id", target.ID).Error; err != nil {
+					return err
+				}
+			}
+			// Moved tasks get a new version so stale edits against the old
+			// lead are rejected.
+			if err := tx.Table("tasks").Where("lead_id = ?", source.ID).
+				Updates(map[string]any{"lead_id": target.ID, "version": gorm.Expr("version + 1")}).Error; err != nil {
+				return err
+			}
+
+			// The duplicate's history moves too, after a marker saying where
+			// it came from, so deleting it below doesn't lose it.
+			for _, table := range []string{"lead_field_changes", "lead_status_history"} {
+				if err := tx.Table(table).Where("lead_id = ?", source.ID).
+					Update("lead_id", target.ID).Error; err != nil {
+					return err
+				}
+			}
+			merged := fmt.Sprintf("%s (%s)", source.InqID, source.FullName)
+			if err := leadhistory.RecordField(tx, target.ID, "merged_lead", nil, &merged, c.GetString("uid")); err != nil {
+				return err
+			}
+
+			// Copy the tags first: deleting the duplicate cascades to its lead_tags.
+			if _, err := leadtag.Move(tx, source.ID, target.ID, c.GetString("uid")); err != nil {
+				return err
+			}
+
+			fill := map[string]any{}
+			for _, col := range mergeColumns {
+				fill[col] = gorm.Expr(fmt.Sprintf("COALESCE(leads.%s, (SELECT s.%s FROM leads s WHERE s.id = ?))", col, col), source.ID)
+			}
+			if err := tx.Model(&models.Lead{}).Where("id = ?", target.ID).Updates(fill).Error; err != nil {
+				return err
+			}
+
+			// Everything worth keeping now lives on the survivor, so the
+			// duplicate is removed for good rather than moved to the trash.
+			if err := tx.Unscoped().Delete(&models.Lead{}, "id = ?", source.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.First(&target, "id = ?", target.ID).Error; err != nil {
+				return err
+			}
+
+			if err := audit.Record(tx, c, "merge", "lead", source.ID, source, gin.H{"merged_into": target.ID}); err != nil {
+				return err
+			}
+			if err := leadhistory.Record(tx, before, target, c.GetString("uid")); err != nil {
+				return err
+			}
+			if err := audit.Record(tx, c, audit.ActionUpdate, "lead", target.ID, before, target); err != nil {
+				return err
+			}
+
+			note := models.LeadNote{
+				LeadID:    target.ID,
+				Body:      fmt.Sprintf("Merged duplicate lead %s (%s) into this lead.", source.InqID, source.FullName),
+				CreatedBy: c.GetString("uid"),
+			}
+			return tx.Create(&note).Error
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "lead not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, target)
+	}
+}
+
+// listLeadDuplicates lets staff look for duplicates of an existing lead
+// before deciding on a merge.
+func listLeadDuplicates(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var m models.Lead
+		if err := db.First(&m, "id = ?", c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not found"}); return
+		}
+		dups, err := findDuplicateLeads(db.Scopes(scope.FromContext(c).Leads("leads")), m.FullName, m.WhatsAppNoE164, m.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"duplicates": dups, "total": len(dups)})
+	}
+}
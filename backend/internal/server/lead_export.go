@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/leadsheet"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+func (r leadWithBranchResp) sheetValues() map[string]string {
+	v := map[string]string{
+		"inq_id":              r.InqID,
+		"full_name":           r.FullName,
+		"branch":              r.BranchName,
+		"whatsapp_no":         r.WhatsAppNo,
+		"allocated_to":        r.AllocatedUserName,
+		"group_name":          deref(r.GroupName),
+		"destination_country": deref(r.DestinationCountry),
+		"field_of_study":      deref(r.FieldOfStudy),
+		"visa_category":       deref(r.VisaCategory),
+		"principal":           deref(r.Principal),
+		"lead_type":           deref(r.LeadType),
+		"team":                deref(r.Team),
+		"status":              deref(r.Status),
+		"contact_method":      deref(r.ContactMethod),
+		"remarks":             deref(r.Remarks),
+		"cc_specialist":       deref(r.CCSpecialist),
+		"cc_all_countries":    deref(r.CCAllCountries),
+		"special_comment":     deref(r.SpecialComment),
+	}
+	if r.InquiryDate != nil {
+		v["inquiry_date"] = r.InquiryDate.Format("2006-01-02")
+	}
+	if r.Age != nil {
+		v["age"] = strconv.Itoa(*r.Age)
+	}
+	if r.GPA != nil {
+		v["gpa"] = strconv.FormatFloat(float64(*r.GPA), 'f', -1, 32)
+	}
+	return v
+}
+
+// exportLeads streams every lead matching the listLeads filters (no paging)
+// as CSV or XLSX in the legacy Excel column order.
+func exportLeads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var f leadFilters
+		if err := c.ShouldBindQuery(&f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"}); return
+		}
+		format := leadsheet.Format(c.DefaultQuery("format", string(leadsheet.FormatCSV)))
+		if format != leadsheet.FormatCSV && format != leadsheet.FormatXLSX {
+			c.JSON(http.StatusBadRequest, gin.H{"error": leadsheet.ErrUnsupportedFormat.Error()}); return
+		}
+
+		rows, err := leadsQuery(db.Scopes(scope.FromContext(c).Leads("leads")), f).Order("leads.inquiry_date ASC NULLS LAST, leads.created_at ASC").Rows()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		defer rows.Close()
+
+		filename := fmt.Sprintf("leads-%s.%s", time.Now().Format("20060102-150405"), format)
+		c.Header("Content-Type", leadsheet.ContentType(format))
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Status(http.StatusOK)
+
+		// Headers are already sent once rows start streaming, so failures
+		// past this point can only be logged.
+		w, err := leadsheet.NewWriter(c.Writer, format)
+		if err != nil {
+			log.Printf("export leads: %v", err)
+			return
+		}
+		for rows.Next() {
+			var r leadWithBranchResp
+			if err := db.ScanRows(rows, &r); err != nil {
+				log.Printf("export leads: scan: %v", err)
+				return
+			}
+			if err := w.Write(r.sheetValues()); err != nil {
+				log.Printf("export leads: write: %v", err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			log.Printf("export leads: rows: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			log.Printf("export leads: close: %v", err)
+		}
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,378 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/allocation"
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/inqid"
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/leadsheet"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/picklist"
+	"github.com/tim-contact/go-crm/internal/pipeline"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+const maxImportBytes = 10 << 20
+
+type importRowResult struct {
+	Row    int      `json:"row"`
+	InqID  string   `json:"inq_id,omitempty"`
+	LeadID string   `json:"lead_id,omitempty"`
+	Action string   `json:"action"` // created, updated, error
+	Errors []string `json:"errors,omitempty"`
+}
+
+type importSummary struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []importRowResult `json:"rows"`
+}
+
+var errDryRun = errors.New("dry run")
+
+const importAllocationReason = "Allocated Person column in imported sheet"
+
+// importLeads accepts a multipart "file" (CSV or XLSX) in the legacy Excel
+// layout and upserts each row on inq_id. Rows that fail validation are
+// reported and skipped; with ?dry_run=true nothing is written.
+func importLeads(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"}); return
+		}
+		format, err := leadsheet.FormatFromFilename(fh.Filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		defer f.Close()
+
+		records, err := leadsheet.Read(f, format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+
+		pl, err := pipeline.Load(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		initialStatus := ""
+		if initial, ok := pl.Initial(); ok {
+			initialStatus = initial.Name
+		}
+		lists := map[string]*picklist.Picklist{}
+		for _, name := range picklist.Lists {
+			if lists[name], err = picklist.Load(db, name); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+		}
+
+		summary := importSummary{DryRun: dryRun, Total: len(records)}
+		users := map[string]string{}
+		viewer := scope.FromContext(c)
+
+		// Everything runs in one transaction with a savepoint per row, so a
+		// dry run exercises the same constraints and is then rolled back.
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i, rec := range records {
+				res := importRowResult{Row: rec.Line, InqID: rec.Get("inq_id")}
+
+				sp := fmt.Sprintf("import_row_%d", i)
+				if err := tx.SavePoint(sp).Error; err != nil {
+					return err
+				}
+
+				values, errs := leadValuesFromRecord(tx, rec, users, pl, lists)
+				var leadID string
+				var created bool
+				if len(errs) == 0 {
+					var err error
+					var before *models.Lead
+					if leadID, created, before, err = upsertLeadByInqID(tx, viewer, pl, values, initialStatus); err == nil {
+						err = recordImport(tx, c, leadID, before, values)
+					}
+					if err != nil {
+						errs = []string{err.Error()}
+					}
+				}
+				if len(errs) > 0 {
+					if err := tx.RollbackTo(sp).Error; err != nil {
+						return err
+					}
+					res.Action, res.Errors = "error", errs
+					summary.Failed++
+					summary.Rows = append(summary.Rows, res)
+					continue
+				}
+
+				res.LeadID = leadID
+				res.InqID, _ = values["inq_id"].(string)
+				if created {
+					res.Action = "created"
+					summary.Created++
+				} else {
+					res.Action = "updated"
+					summary.Updated++
+				}
+				summary.Rows = append(summary.Rows, res)
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errDryRun) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// leadValuesFromRecord converts a sheet row into lead column values, resolving
+// the branch and allocated person by name. users caches name lookups. TYPE and
+// METHOD must be picklist options; inactive ones are accepted so exported
+// sheets re-import cleanly.
+func leadValuesFromRecord(tx *gorm.DB, rec leadsheet.Record, users map[string]string, pl *pipeline.Pipeline, lists map[string]*picklist.Picklist) (map[string]any, []string) {
+	values := map[string]any{}
+	var errs []string
+
+	for _, col := range leadsheet.Columns {
+		v := rec.Get(col.Field)
+		if v == "" {
+			continue
+		}
+		switch col.Field {
+		case "inquiry_date":
+			d, err := leadsheet.ParseDate(v)
+			if err != nil {
+				errs = append(errs, "DATE: "+err.Error())
+				continue
+			}
+			values["inquiry_date"] = d
+		case "age":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 10 || n > 90 {
+				errs = append(errs, fmt.Sprintf("AGE: %q must be a number between 10 and 90", v))
+				continue
+			}
+			values["age"] = n
+		case "gpa":
+			g, err := strconv.ParseFloat(v, 32)
+			if err != nil || g < 0 || g > 4 {
+				errs = append(errs, fmt.Sprintf("GPA: %q must be between 0 and 4", v))
+				continue
+			}
+			values["gpa"] = g
+		case "whatsapp_no":
+			values["whatsapp_no"] = digitsOnly(v)
+			if e164 := normalizeWhatsApp(v); e164 != nil {
+				values["whatsapp_no_e164"] = *e164
+			}
+		case "branch":
+			id, err := resolveBranchIDByName(tx, v)
+			if err != nil {
+				errs = append(errs, "BRANCH: "+err.Error())
+				continue
+			}
+			values["branch_id"] = id
+		case "status":
+			st, ok := pl.Lookup(v)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("STATUS: unknown status %q", v))
+				continue
+			}
+			values["status"] = st.Name
+		case "lead_type", "contact_method":
+			o, ok := lists[col.Field].Lookup(v)
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s: unknown option %q", col.Header, v))
+				continue
+			}
+			values[col.Field] = o.Value
+		case "allocated_to":
+			id, err := resolveUserIDByName(tx, v, users)
+			if err != nil {
+				errs = append(errs, "Allocated Person: "+err.Error())
+				continue
+			}
+			values["allocated_user_id"] = id
+		default:
+			values[col.Field] = v
+		}
+	}
+
+	if rec.Get("full_name") == "" {
+		errs = append(errs, "STUDENT NAME is required")
+	}
+	if rec.Get("whatsapp_no") == "" {
+		errs = append(errs, "WA NO is required")
+	}
+	return values, errs
+}
+
+// upsertLeadByInqID inserts the lead or, if inq_id already exists, updates the
+// non-empty columns from the sheet. Empty cells never clear existing data.
+// Updates are limited to leads v can see and, like PUT /leads/:id, to
+// allowed status transitions.
+// Rows without an INQ ID are always new and get a generated one, written back
+// into values. New leads without a STATUS start in initialStatus and, without
+// an Allocated Person, go through the allocation rules; before is the lead
+// as it was before an update.
+func upsertLeadByInqID(tx *gorm.DB, v scope.Viewer, pl *pipeline.Pipeline, values map[string]any, initialStatus string) (id string, created bool, before *models.Lead, err error) {
+	var existing models.Lead
+	if _, ok := values["inq_id"]; ok {
+		if err := tx.Unscoped().Where("inq_id = ?", values["inq_id"]).Limit(1).Find(&existing).Error; err != nil {
+			return "", false, nil, err
+		}
+		if existing.DeletedAt.Valid {
+			return "", false, nil, fmt.Errorf("INQ ID %v belongs to a deleted lead; restore it first", values["inq_id"])
+		}
+	} else {
+		at := time.Now()
+		if d, ok := values["inquiry_date"].(time.Time); ok {
+			at = d
+		}
+		inq, err := inqid.Next(tx, stringValue(values, "branch_id"), at)
+		if err != nil {
+			return "", false, nil, err
+		}
+		values["inq_id"] = inq
+	}
+
+	if existing.ID != "" {
+		if ok, err := v.CanSeeLead(tx, existing.ID); err != nil {
+			return "", false, nil, err
+		} else if !ok {
+			return "", false, nil, fmt.Errorf("INQ ID %v belongs to a lead outside your scope", values["inq_id"])
+		}
+		if status, ok := values["status"].(string); ok {
+			name, err := pl.Resolve(existing.Status, status)
+			if err != nil {
+				return "", false, nil, fmt.Errorf("STATUS: %w", err)
+			}
+			values["status"] = name
+		}
+		if userID, ok := values["allocated_user_id"].(string); ok && !sameString(existing.AllocatedUserID, &userID) {
+			values["allocation_reason"] = importAllocationReason
+		}
+		if err := tx.Table("leads").Where("id = ?", existing.ID).Updates(values).Error; err != nil {
+			return "", false, nil, err
+		}
+		return existing.ID, false, &existing, nil
+	}
+
+	if _, ok := values["status"]; !ok && initialStatus != "" {
+		values["status"] = initialStatus
+	}
+	if _, ok := values["allocated_user_id"]; ok {
+		values["allocation_reason"] = importAllocationReason
+	} else {
+		res, err := allocation.Allocate(tx, allocation.Input{
+			BranchID:           stringValue(values, "branch_id"),
+			DestinationCountry: stringValue(values, "destination_country"),
+			VisaCategory:       stringValue(values, "visa_category"),
+		})
+		if err != nil {
+			return "", false, nil, err
+		}
+		if res != nil {
+			values["allocated_user_id"] = res.UserID
+			values["allocation_reason"] = res.Reason
+		}
+	}
+	if err := tx.Table("leads").Create(values).Error; err != nil {
+		return "", false, nil, err
+	}
+	if err := tx.Table("leads").Select("id").
+		Where("inq_id = ?", values["inq_id"]).Limit(1).Scan(&id).Error; err != nil {
+		return "", false, nil, err
+	}
+	return id, true, nil, nil
+}
+
+// recordImport writes the audit entry and, when the status was set or
+// changed, the status history for an imported row. For updated leads it also
+// records which fields the sheet changed.
+func recordImport(tx *gorm.DB, c *gin.Context, leadID string, before *models.Lead, values map[string]any) error {
+	var prevStatus *string
+	if before != nil {
+		prevStatus = before.Status
+	}
+	if status, ok := values["status"].(string); ok {
+		if err := pipeline.RecordChange(tx, leadID, prevStatus, status, c.GetString("uid")); err != nil {
+			return err
+		}
+	}
+	action := audit.ActionCreate
+	if before != nil {
+		action = audit.ActionUpdate
+		var after models.Lead
+		if err := tx.First(&after, "id = ?", leadID).Error; err != nil {
+			return err
+		}
+		if err := leadhistory.Record(tx, *before, after, c.GetString("uid")); err != nil {
+			return err
+		}
+	}
+	return audit.Record(tx, c, action, "lead", leadID, nil, values)
+}
+
+func resolveUserIDByName(db *gorm.DB, name string, cache map[string]string) (string, error) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if id, ok := cache[key]; ok {
+		return id, nil
+	}
+
+	var ids []string
+	if err := db.Table("users").
+		Where("lower(name) = ? AND active = TRUE", key).
+		Pluck("id", &ids).Error; err != nil {
+		return "", err
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no active user named %q", name)
+	case 1:
+		cache[key] = ids[0]
+		return ids[0], nil
+	}
+	return "", fmt.Errorf("%d users named %q, allocate manually", len(ids), name)
+}
+
+func stringValue(values map[string]any, key string) *string {
+	if v, ok := values[key].(string); ok {
+		return &v
+	}
+	return nil
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
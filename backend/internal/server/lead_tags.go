@@ -0,0 +1,96 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/leadtag"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// filterByTags keeps leads carrying any (the default), all or none of the
+// comma-separated tag IDs.
+func filterByTags(q *gorm.DB, tags, mode string) *gorm.DB {
+	var ids []string
+	seen := map[string]bool{}
+	for _, id := range strings.Split(tags, ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return q
+	}
+
+	const tagged = "SELECT 1 FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ?"
+	switch mode {
+	case "all":
+		return q.Where("(SELECT COUNT(*) FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ?) = ?", ids, len(ids))
+	case "none":
+		return q.Where("NOT EXISTS ("+tagged+")", ids)
+	default:
+		return q.Where("EXISTS ("+tagged+")", ids)
+	}
+}
+
+// attachTags fills in the tags of a page of leads.
+func attachTags(db *gorm.DB, leads []leadWithBranchResp) error {
+	ids := make([]string, len(leads))
+	for i, l := range leads {
+		ids[i] = l.ID
+	}
+	tags, err := leadtag.ForLeads(db, ids)
+	if err != nil {
+		return err
+	}
+	for i := range leads {
+		leads[i].Tags = tags[leads[i].ID]
+	}
+	return nil
+}
+
+type tagCount struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Color *string `json:"color,omitempty"`
+	Leads int64   `json:"leads"`
+}
+
+// leadTagCounts counts, for every tag, the leads matching the listLeads
+// filters. The tag filter itself is ignored so picking a tag in the sidebar
+// doesn't hide the counts of the others.
+func leadTagCounts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var f leadFilters
+		if err := c.ShouldBindQuery(&f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"})
+			return
+		}
+		f.Tags = ""
+		matching := leadsQuery(db.Scopes(scope.FromContext(c).Leads("leads")), f).Select("leads.id")
+
+		out := []tagCount{}
+		if err := db.Table("tags").
+			Select("tags.id, tags.name, tags.color, COUNT(lt.lead_id) AS leads").
+			Joins("LEFT JOIN lead_tags lt ON lt.tag_id = tags.id AND lt.lead_id IN (?)", matching).
+			Group("tags.id").
+			Order("lower(tags.name)").
+			Scan(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var untagged int64
+		if err := leadsQuery(db.Scopes(scope.FromContext(c).Leads("leads")), f).
+			Where("NOT EXISTS (SELECT 1 FROM lead_tags lt WHERE lt.lead_id = leads.id)").
+			Count(&untagged).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": out, "untagged": untagged})
+	}
+}
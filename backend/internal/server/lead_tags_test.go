@@ -0,0 +1,55 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// dryRunDB renders SQL without a database.
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFilterByTags(t *testing.T) {
+	db := dryRunDB(t)
+	const base = `SELECT leads.id FROM "leads"`
+	tests := []struct {
+		name string
+		tags string
+		mode string
+		want string
+	}{
+		{"no tags", "", "", base},
+		{"only separators", " , ,", "all", base},
+		{"any by default", "t1,t2", "",
+			base + ` WHERE EXISTS (SELECT 1 FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ('t1','t2'))`},
+		{"unknown mode is any", "t1", "some",
+			base + ` WHERE EXISTS (SELECT 1 FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ('t1'))`},
+		{"all counts distinct tags", "t1, t2,t1", "all",
+			base + ` WHERE (SELECT COUNT(*) FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ('t1','t2')) = 2`},
+		{"none", "t1", "none",
+			base + ` WHERE NOT EXISTS (SELECT 1 FROM lead_tags lt WHERE lt.lead_id = leads.id AND lt.tag_id::text IN ('t1'))`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				var ids []string
+				return filterByTags(tx.Table("leads"), tt.tags, tt.mode).Select("leads.id").Find(&ids)
+			})
+			if strings.TrimSpace(got) != tt.want {
+				t.Errorf("filterByTags(%q, %q):\n got %s\nwant %s", tt.tags, tt.mode, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// Timeline entry types.
+const (
+	timelineFieldChange   = "field_change"
+	timelineStatusChange  = "status_change"
+	timelineNote          = "note"
+	timelineActivity      = "activity"
+	timelineTaskCreated   = "task_created"
+	timelineTaskCompleted = "task_completed"
+)
+
+// timelineSources select one kind of entry each as (type, id, at, actor_id,
+// data). Sources whose permission the caller lacks are left out.
+var timelineSources = []struct {
+	permission string
+	sql        string
+}{
+	{permission.LeadRead, `SELECT '` + timelineFieldChange + `' AS type, id::text AS id, changed_at AS at, changed_by AS actor_id,
+		jsonb_build_object('field', field, 'old_value', old_value, 'new_value', new_value) AS data
+		FROM lead_field_changes WHERE lead_id = @lead`},
+	{permission.LeadRead, `SELECT '` + timelineStatusChange + `', id::text, changed_at, changed_by,
+		jsonb_build_object('from_status', from_status, 'to_status', to_status)
+		FROM lead_status_history WHERE lead_id = @lead`},
+	{permission.NoteRead, `SELECT '` + timelineNote + `', id::text, created_at, created_by,
+		jsonb_build_object('body', body)
+		FROM lead_notes WHERE lead_id = @lead`},
+	{permission.ActivityRead, `SELECT '` + timelineActivity + `', id::text, occurred_at, staff_id,
+		jsonb_build_object('kind', kind, 'summary', summary)
+		FROM activities WHERE lead_id = @lead`},
+	// Tasks don't store their creator; the audit log does.
+	{permission.TaskRead, `SELECT '` + timelineTaskCreated + `', t.id::text, t.created_at,
+		(SELECT a.actor_id FROM audit_logs a WHERE a.entity = 'task' AND a.action = 'create' AND a.entity_id = t.id::text LIMIT 1),
+		jsonb_build_object('title', t.title, 'kind', t.kind, 'due_date', t.due_date, 'assigned_to', t.assigned_to)
+		FROM tasks t WHERE t.lead_id = @lead`},
+	{permission.TaskRead, `SELECT '` + timelineTaskCompleted + `', id::text, completed_at, completed_by,
+		jsonb_build_object('title', title, 'kind', kind)
+		FROM tasks WHERE lead_id = @lead AND status = 'done' AND completed_at IS NOT NULL`},
+}
+
+type timelineFilters struct {
+	Order  string `form:"order,default=asc" binding:"oneof=asc desc"`
+	Limit  int    `form:"limit,default=50"`
+	Offset int    `form:"offset,default=0"`
+}
+
+type timelineEntry struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id"`
+	At        time.Time       `json:"at"`
+	ActorID   *string         `json:"actor_id"`
+	ActorName *string         `json:"actor_name"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// leadTimeline is everything that happened to a lead in one feed: field
+// edits, status moves, notes, activities, and tasks created and completed.
+// Oldest first unless order=desc.
+func leadTimeline(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var f timelineFilters
+		if err := c.ShouldBindQuery(&f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"})
+			return
+		}
+		if f.Limit <= 0 || f.Limit > 200 {
+			f.Limit = 50
+		}
+		if f.Offset < 0 {
+			f.Offset = 0
+		}
+
+		have := scope.FromContext(c).Permissions
+		var parts []string
+		for _, s := range timelineSources {
+			if have.Has(s.permission) {
+				parts = append(parts, s.sql)
+			}
+		}
+		union := strings.Join(parts, "\nUNION ALL\n")
+		args := map[string]any{"lead": c.Param("id"), "limit": f.Limit, "offset": f.Offset}
+
+		var total int64
+		if err := db.Raw("SELECT COUNT(*) FROM ("+union+") t", args).Scan(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		dir := strings.ToUpper(f.Order)
+		out := []timelineEntry{}
+		if err := db.Raw(`SELECT t.*, u.name AS actor_name FROM (`+union+`) t
+			LEFT JOIN users u ON u.id = t.actor_id
+			ORDER BY t.at `+dir+`, t.id `+dir+`
+			LIMIT @limit OFFSET @offset`, args).Scan(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries": out,
+			"total":   total,
+			"limit":   f.Limit,
+			"offset":  f.Offset,
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// The purge job runs every purgeInterval and deletes up to purgeBatch leads
+// per transaction.
+const (
+	purgeInterval = time.Hour
+	purgeBatch    = 200
+)
+
+type deletedLeadResp struct {
+	leadWithBranchResp
+	DeletedByName string    `json:"deleted_by_name"`
+	PurgeAt       time.Time `json:"purge_at" gorm:"-"`
+}
+
+type trashFilters struct {
+	Q      string `form:"q"`
+	Limit  int    `form:"limit,default=50"`
+	Offset int    `form:"offset,default=0"`
+}
+
+// listDeletedLeads is the trash: deleted leads, newest first, with when each
+// will be purged.
+func listDeletedLeads(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var f trashFilters
+		if err := c.ShouldBindQuery(&f); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"})
+			return
+		}
+		if f.Limit <= 0 || f.Limit > 200 {
+			f.Limit = 50
+		}
+		if f.Offset < 0 {
+			f.Offset = 0
+		}
+
+		q := db.Table("leads").
+			Select("leads.*, COALESCE(branches.name, '') AS branch_name, COALESCE(u.name, '') AS allocated_user_name, COALESCE(d.name, '') AS deleted_by_name").
+			Joins("LEFT JOIN branches ON branches.id = leads.branch_id").
+			Joins("LEFT JOIN users u ON u.id = leads.allocated_user_id").
+			Joins("LEFT JOIN users d ON d.id = leads.deleted_by").
+			Scopes(scope.FromContext(c).DeletedLeads("leads"))
+		if f.Q != "" {
+			like := "%" + f.Q + "%"
+			q = q.Where("(leads.full_name ILIKE ? OR leads.whatsapp_no ILIKE ? OR leads.inq_id ILIKE ?)", like, like, like)
+		}
+
+		var total int64
+		if err := q.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := []deletedLeadResp{}
+		if err := q.Order("leads.deleted_at DESC, leads.id DESC").Limit(f.Limit).Offset(f.Offset).Scan(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i := range out {
+			out[i].PurgeAt = out[i].DeletedAt.Time.Add(cfg.LeadTrashRetention)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"leads":          out,
+			"total":          total,
+			"limit":          f.Limit,
+			"offset":         f.Offset,
+			"retention_days": int(cfg.LeadTrashRetention.Hours() / 24),
+		})
+	}
+}
+
+// findDeletedLead loads a trashed lead, but only one v could see before it
+// was deleted; anything else is not found.
+func findDeletedLead(tx *gorm.DB, v scope.Viewer, id string, m *models.Lead) *gorm.DB {
+	return tx.Unscoped().Scopes(v.DeletedLeads("leads")).First(m, "leads.id = ?", id)
+}
+
+// restoreLead takes a lead out of the trash with its history intact.
+func restoreLead(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var m models.Lead
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := findDeletedLead(tx, scope.FromContext(c), id, &m).Error; err != nil {
+				return err
+			}
+			before := m
+			if err := tx.Unscoped().Model(&models.Lead{}).Where("id = ?", id).
+				Updates(map[string]any{"deleted_at": nil, "deleted_by": nil}).Error; err != nil {
+				return err
+			}
+			m = models.Lead{}
+			if err := tx.First(&m, "id = ?", id).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionRestore, "lead", m.ID, before, m)
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not found in trash"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, m)
+	}
+}
+
+// RunLeadPurge deletes leads that have been in the trash longer than
+// retention, along with their notes, activities, tasks and status history,
+// until ctx is cancelled. Every instance may run it; the deletes are
+// idempotent.
+func RunLeadPurge(ctx context.Context, db *gorm.DB, retention time.Duration) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := purgeDeletedLeads(db, time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("lead purge: %v", err)
+		} else if n > 0 {
+			log.Printf("lead purge: removed %d lead(s) deleted more than %s ago", n, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeletedLeads hard-deletes leads deleted before cutoff. Each lead's
+// last state is kept in the audit log.
+func purgeDeletedLeads(db *gorm.DB, cutoff time.Time) (int, error) {
+	total := 0
+	for {
+		n := 0
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var leads []models.Lead
+			if err := tx.Unscoped().
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+				Order("deleted_at ASC").Limit(purgeBatch).
+				Find(&leads).Error; err != nil {
+				return err
+			}
+			for _, l := range leads {
+				if err := tx.Unscoped().Delete(&models.Lead{}, "id = ?", l.ID).Error; err != nil {
+					return err
+				}
+				if err := audit.RecordSystem(tx, audit.ActionPurge, "lead", l.ID, l, nil); err != nil {
+					return err
+				}
+			}
+			n = len(leads)
+			return nil
+		})
+		total += n
+		if err != nil || n < purgeBatch {
+			return total, err
+		}
+	}
+}
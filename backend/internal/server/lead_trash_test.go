@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+func TestFindDeletedLeadScope(t *testing.T) {
+	db := dryRunDB(t)
+	const base = `SELECT * FROM "leads" WHERE leads.id = 'l1' AND leads.deleted_at IS NOT NULL`
+	const own = `leads.allocated_user_id = 'u1' OR EXISTS (SELECT 1 FROM tasks st WHERE st.lead_id = leads.id AND st.assigned_to = 'u1')`
+	const tail = ` ORDER BY "leads"."id" LIMIT 1`
+
+	tests := []struct {
+		name   string
+		viewer scope.Viewer
+		want   string
+	}{
+		{"all leads",
+			scope.Viewer{UserID: "u1", Permissions: permission.NewSet(permission.LeadRead, permission.LeadReadAll)},
+			base + tail},
+		{"branch",
+			scope.Viewer{UserID: "u1", BranchID: "b1", Permissions: permission.NewSet(permission.LeadRead, permission.LeadReadBranch)},
+			base + ` AND ((leads.branch_id = 'b1' OR ` + own + `))` + tail},
+		{"own only",
+			scope.Viewer{UserID: "u1", Permissions: permission.NewSet(permission.LeadRead)},
+			base + ` AND ((` + own + `))` + tail},
+		{"branch permission without a branch",
+			scope.Viewer{UserID: "u1", Permissions: permission.NewSet(permission.LeadRead, permission.LeadReadBranch)},
+			base + ` AND ((` + own + `))` + tail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+				var m models.Lead
+				return findDeletedLead(tx, tt.viewer, "l1", &m)
+			})
+			if got != tt.want {
+				t.Errorf("SQL\n got: %s\nwant: %s", got, tt.want)
+			}
+		})
+	}
+}
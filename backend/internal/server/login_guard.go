@@ -0,0 +1,219 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+// Brute-force protection. An account is locked after lockoutThreshold
+// consecutive failures, and an IP is throttled after ipFailureLimit failures
+// within ipFailureWindow. Each further failure doubles the wait, up to
+// lockoutMax.
+const (
+	lockoutThreshold = 5
+	lockoutBase      = time.Minute
+	lockoutMax       = time.Hour
+
+	ipFailureLimit  = 20
+	ipFailureWindow = 15 * time.Minute
+
+	// Unknown emails have no account to carry a failure count, so theirs
+	// comes from login_attempts over this window instead.
+	unknownEmailWindow = 24 * time.Hour
+)
+
+// Reasons stored on login_attempts.
+const (
+	loginReasonUnknownEmail = "unknown_email"
+	loginReasonBadPassword  = "bad_password"
+	loginReasonBadMFACode   = "bad_mfa_code"
+	loginReasonBadMFAToken  = "bad_mfa_token"
+	loginReasonResetRequest = "password_forgot"
+	loginReasonBadReset     = "bad_reset_token"
+	loginReasonLocked       = "locked"
+	loginReasonThrottled    = "ip_throttled"
+)
+
+// backoff is the wait after n failures past the threshold (n >= 1).
+func backoff(n int) time.Duration {
+	d := lockoutBase * time.Duration(math.Pow(2, float64(n-1)))
+	if d <= 0 || d > lockoutMax {
+		return lockoutMax
+	}
+	return d
+}
+
+// ipRetryAfter reports how long ip must wait before trying again, or 0.
+// Throttled and locked attempts don't count, so waiting it out works.
+func ipRetryAfter(db *gorm.DB, ip string) time.Duration {
+	var row struct {
+		Failures int
+		Last     *time.Time
+	}
+	err := db.Model(&models.LoginAttempt{}).
+		Select("COUNT(*) AS failures, MAX(created_at) AS last").
+		Where("ip = ? AND success = FALSE AND created_at > ? AND reason NOT IN ?",
+			ip, time.Now().Add(-ipFailureWindow), []string{loginReasonLocked, loginReasonThrottled}).
+		Scan(&row).Error
+	if err != nil {
+		log.Printf("login guard: count failures for %s: %v", ip, err)
+		return 0
+	}
+	return retryAfter(row.Failures, ipFailureLimit, row.Last, time.Now())
+}
+
+// retryAfter is the wait left at now after failures, the last at last, once
+// limit is reached; 0 below it.
+func retryAfter(failures, limit int, last *time.Time, now time.Time) time.Duration {
+	if failures < limit || last == nil {
+		return 0
+	}
+	if wait := last.Add(backoff(failures - limit + 1)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// unknownEmailRetryAfter locks out an email with no account the same way a
+// real one is locked, so the 429 doesn't reveal which emails exist.
+func unknownEmailRetryAfter(db *gorm.DB, email string) time.Duration {
+	var row struct {
+		Failures int
+		Last     *time.Time
+	}
+	err := db.Model(&models.LoginAttempt{}).
+		Select("COUNT(*) AS failures, MAX(created_at) AS last").
+		Where("email = ? AND user_id IS NULL AND success = FALSE AND reason = ? AND created_at > ?",
+			email, loginReasonUnknownEmail, time.Now().Add(-unknownEmailWindow)).
+		Scan(&row).Error
+	if err != nil {
+		log.Printf("login guard: count failures for %s: %v", email, err)
+		return 0
+	}
+	return retryAfter(row.Failures, lockoutThreshold, row.Last, time.Now())
+}
+
+// ipThrottled answers 429 and reports true while the client's IP must wait.
+// Every unauthenticated auth endpoint checks it first.
+func ipThrottled(db *gorm.DB, c *gin.Context, email string) bool {
+	wait := ipRetryAfter(db, c.ClientIP())
+	if wait <= 0 {
+		return false
+	}
+	recordLoginAttempt(db, c, email, nil, false, loginReasonThrottled)
+	tooManyAttempts(c, wait)
+	return true
+}
+
+func accountRetryAfter(u models.User) time.Duration {
+	if u.LockedUntil == nil {
+		return 0
+	}
+	return time.Until(*u.LockedUntil)
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts, try again later", "retry_after": secs})
+}
+
+func recordLoginAttempt(db *gorm.DB, c *gin.Context, email string, userID *string, success bool, reason string) {
+	a := models.LoginAttempt{
+		UserID:  userID,
+		Email:   email,
+		Success: success,
+	}
+	if ip := c.ClientIP(); ip != "" {
+		a.IP = &ip
+	}
+	if ua := c.Request.UserAgent(); ua != "" {
+		a.UserAgent = &ua
+	}
+	if reason != "" {
+		a.Reason = &reason
+	}
+	if err := db.Create(&a).Error; err != nil {
+		log.Printf("login guard: record attempt for %s: %v", email, err)
+	}
+}
+
+// loginFailed records the failure and, for a known account, bumps its failure
+// count and extends the lock once past the threshold.
+func loginFailed(db *gorm.DB, c *gin.Context, email string, u *models.User, reason string) {
+	var uid *string
+	if u != nil {
+		uid = &u.ID
+		failures := u.FailedLoginCount + 1
+		updates := map[string]any{"failed_login_count": gorm.Expr("failed_login_count + 1")}
+		if failures >= lockoutThreshold {
+			updates["locked_until"] = time.Now().Add(backoff(failures - lockoutThreshold + 1))
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", u.ID).Updates(updates).Error; err != nil {
+			log.Printf("login guard: count failure for %s: %v", u.ID, err)
+		}
+	}
+	recordLoginAttempt(db, c, email, uid, false, reason)
+}
+
+func loginSucceeded(db *gorm.DB, c *gin.Context, u models.User) {
+	if err := db.Model(&models.User{}).Where("id = ?", u.ID).Updates(map[string]any{
+		"failed_login_count": 0,
+		"locked_until": nil,
+		"last_login_at": time.Now(),
+	}).Error; err != nil {
+		log.Printf("login: record success for %s: %v", u.ID, err)
+	}
+	recordLoginAttempt(db, c, u.Email, &u.ID, true, "")
+}
+
+// unlockUser clears an account lockout early.
+func unlockUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.User{}).Where("id = ?", id).
+				Updates(map[string]any{"failed_login_count": 0, "locked_until": nil})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return audit.Record(tx, c, "unlock", "user", id, nil, gin.H{"locked_until": nil})
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// listLoginAttempts returns a user's recent sign-in attempts, newest first.
+func listLoginAttempts(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 50
+		if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 && v <= 500 {
+			limit = v
+		}
+		var out []models.LoginAttempt
+		if err := db.Where("user_id = ?", c.Param("id")).
+			Order("created_at DESC").Limit(limit).Find(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"attempts": out, "total": len(out)})
+	}
+}
@@ -0,0 +1,35 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+
+	tests := []struct {
+		name     string
+		failures int
+		last     *time.Time
+		want     time.Duration
+	}{
+		{"below threshold", lockoutThreshold - 1, at(0), 0},
+		{"no attempts", 0, nil, 0},
+		{"at threshold", lockoutThreshold, at(10 * time.Second), 50 * time.Second},
+		{"doubles past threshold", lockoutThreshold + 1, at(0), 2 * time.Minute},
+		{"capped", lockoutThreshold + 30, at(0), lockoutMax},
+		{"waited out", lockoutThreshold, at(2 * time.Minute), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.failures, lockoutThreshold, tt.last, now); got != tt.want {
+				t.Errorf("retryAfter(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/models"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errMFATokenInvalid   = errors.New("invalid or expired mfa token")
+	errMFACodeInvalid    = errors.New("invalid code")
+	errMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errMFANotStarted     = errors.New("start enrollment first")
+	errMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+)
+
+// completeLogin issues a session once every login factor has been checked.
+func completeLogin(db *gorm.DB, c *gin.Context, u models.User) (gin.H, error) {
+	pair, _, err := issueSession(db, c, u, "")
+	if err != nil {
+		return nil, err
+	}
+	loginSucceeded(db, c, u)
+	return gin.H{
+		"access_token": pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_in": pair.ExpiresIn,
+		"user": gin.H{
+			"id": u.ID, "name": u.Name, "email": u.Email, "role": u.Role,
+		},
+	}, nil
+}
+
+// mfaChallenge is what login returns instead of a session when a second
+// factor is needed: either a TOTP code, or (when the role requires MFA and
+// the user has none yet) enrollment.
+func mfaChallenge(cfg config.Config, u models.User) (gin.H, bool, error) {
+	if !u.MFAEnabled && !cfg.MFARequired(u.Role) {
+		return nil, false, nil
+	}
+	purpose := auth.PurposeMFAChallenge
+	if !u.MFAEnabled {
+		purpose = auth.PurposeMFAEnroll
+	}
+	tok, err := auth.NewPurposeToken(u.ID, u.Role, u.TokenVersion, purpose, auth.MFATokenTTL)
+	if err != nil {
+		return nil, true, err
+	}
+	return gin.H{
+		"mfa_required": u.MFAEnabled,
+		"mfa_enrollment_required": !u.MFAEnabled,
+		"mfa_token": tok,
+		"expires_in": int(auth.MFATokenTTL.Seconds()),
+	}, true, nil
+}
+
+// mfaTokenUser resolves the user behind a login-step token. The token
+// version check means a password reset or admin revoke kills pending
+// challenges too.
+func mfaTokenUser(db *gorm.DB, token, purpose string) (models.User, error) {
+	var u models.User
+	claims, err := auth.ParsePurpose(token, purpose)
+	if err != nil {
+		return u, errMFATokenInvalid
+	}
+	if err := db.Where("id = ? AND active = TRUE", claims.UserID).First(&u).Error; err != nil {
+		return u, errMFATokenInvalid
+	}
+	if u.TokenVersion != claims.TokenVersion {
+		return u, errMFATokenInvalid
+	}
+	return u, nil
+}
+
+type mfaVerifyReq struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// mfaVerify is the second login step: it trades the challenge token plus a
+// TOTP or recovery code for a session.
+func mfaVerify(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mfaVerifyReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if (req.Code == "") == (req.RecoveryCode == "") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "provide either code or recovery_code"}); return
+		}
+		if ipThrottled(db, c, "") {
+			return
+		}
+		u, err := mfaTokenUser(db, req.MFAToken, auth.PurposeMFAChallenge)
+		if err != nil {
+			recordLoginAttempt(db, c, "", nil, false, loginReasonBadMFAToken)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()}); return
+		}
+		if wait := accountRetryAfter(u); wait > 0 {
+			recordLoginAttempt(db, c, u.Email, &u.ID, false, loginReasonLocked)
+			tooManyAttempts(c, wait)
+			return
+		}
+
+		var remaining int64 = -1
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if req.Code != "" {
+				return checkTOTP(tx, u.ID, req.Code)
+			}
+			n, err := useRecoveryCode(tx, c, u.ID, req.RecoveryCode)
+			remaining = n
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, errMFACodeInvalid) {
+				loginFailed(db, c, u.Email, &u, loginReasonBadMFACode)
+			}
+			if errors.Is(err, errMFACodeInvalid) || errors.Is(err, errMFANotEnabled) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+
+		resp, err := completeLogin(db, c, u)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate token"}); return
+		}
+		if remaining >= 0 {
+			resp["recovery_codes_remaining"] = remaining
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// checkTOTP validates code for an enrolled user. Each code is accepted once:
+// the matched time step is stored and older or equal steps are refused.
+func checkTOTP(tx *gorm.DB, userID, code string) error {
+	var u models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&u).Error; err != nil {
+		return err
+	}
+	if !u.MFAEnabled || u.MFASecret == nil {
+		return errMFANotEnabled
+	}
+	step, ok := acceptTOTP(*u.MFASecret, u.MFALastStep, code, time.Now())
+	if !ok {
+		return errMFACodeInvalid
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("mfa_last_step", step).Error
+}
+
+// acceptTOTP validates code and refuses a time step at or before lastStep,
+// so a code (or an older one still within the skew) can't be replayed.
+func acceptTOTP(secret string, lastStep *int64, code string, now time.Time) (int64, bool) {
+	step, ok := auth.ValidateTOTP(secret, code, now)
+	if !ok || (lastStep != nil && step <= *lastStep) {
+		return 0, false
+	}
+	return step, true
+}
+
+// useRecoveryCode burns one recovery code and returns how many are left.
+func useRecoveryCode(tx *gorm.DB, c *gin.Context, userID, code string) (int64, error) {
+	var rc models.MFARecoveryCode
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, auth.HashToken(auth.NormalizeRecoveryCode(code))).
+		First(&rc).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, errMFACodeInvalid
+		}
+		return 0, err
+	}
+	if err := tx.Model(&rc).Update("used_at", time.Now()).Error; err != nil {
+		return 0, err
+	}
+	var remaining int64
+	if err := tx.Model(&models.MFARecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining).Error; err != nil {
+		return 0, err
+	}
+	c.Set("uid", userID)
+	return remaining, audit.Record(tx, c, "mfa_recovery_code_used", "user", userID, nil, gin.H{"recovery_codes_remaining": remaining})
+}
+
+// replaceRecoveryCodes discards any existing codes and returns a new set.
+// Only hashes are stored, so this is the one time the codes are visible.
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]models.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		id, err := gonanoid.New(16)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = models.MFARecoveryCode{ID: id, UserID: userID, CodeHash: auth.HashToken(code)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// startMFAEnrollment stores a fresh, not yet active secret for u.
+func startMFAEnrollment(db *gorm.DB, cfg config.Config, u models.User) (gin.H, error) {
+	if u.MFAEnabled {
+		return nil, errMFAAlreadyEnabled
+	}
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", u.ID).
+		Updates(map[string]any{"mfa_secret": secret, "mfa_last_step": nil}).Error; err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"secret": secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(cfg.MFAIssuer, u.Email, secret),
+	}, nil
+}
+
+// confirmMFAEnrollment turns MFA on once the user proves their app produces
+// valid codes, and hands out recovery codes.
+func confirmMFAEnrollment(tx *gorm.DB, c *gin.Context, userID, code string) ([]string, error) {
+	var u models.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&u).Error; err != nil {
+		return nil, err
+	}
+	if u.MFAEnabled {
+		return nil, errMFAAlreadyEnabled
+	}
+	if u.MFASecret == nil {
+		return nil, errMFANotStarted
+	}
+	step, ok := auth.ValidateTOTP(*u.MFASecret, code, time.Now())
+	if !ok {
+		return nil, errMFACodeInvalid
+	}
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]any{"mfa_enabled": true, "mfa_last_step": step}).Error; err != nil {
+		return nil, err
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	c.Set("uid", userID)
+	return codes, audit.Record(tx, c, "mfa_enable", "user", userID, nil, gin.H{"mfa_enabled": true})
+}
+
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errMFATokenInvalid), errors.Is(err, errMFACodeInvalid):
+		return http.StatusUnauthorized
+	case errors.Is(err, errMFAAlreadyEnabled), errors.Is(err, errMFANotStarted), errors.Is(err, errMFANotEnabled):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+type mfaTokenReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// mfaEnroll starts enrollment for a user whose role requires MFA but who
+// hasn't set it up yet; they only have the token login gave them.
+func mfaEnroll(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mfaTokenReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		u, err := mfaTokenUser(db, req.MFAToken, auth.PurposeMFAEnroll)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()}); return
+		}
+		out, err := startMFAEnrollment(db, cfg, u)
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+type mfaEnrollConfirmReq struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// mfaEnrollConfirm finishes forced enrollment and signs the user in.
+func mfaEnrollConfirm(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mfaEnrollConfirmReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		u, err := mfaTokenUser(db, req.MFAToken, auth.PurposeMFAEnroll)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()}); return
+		}
+		if wait := accountRetryAfter(u); wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+		var codes []string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			codes, err = confirmMFAEnrollment(tx, c, u.ID, req.Code)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, errMFACodeInvalid) {
+				loginFailed(db, c, u.Email, &u, loginReasonBadMFACode)
+			}
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()}); return
+		}
+		resp, err := completeLogin(db, c, u)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate token"}); return
+		}
+		resp["recovery_codes"] = codes
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func currentUser(db *gorm.DB, c *gin.Context) (models.User, error) {
+	var u models.User
+	err := db.Where("id = ?", c.GetString("uid")).First(&u).Error
+	return u, err
+}
+
+// setupOwnMFA starts voluntary enrollment for the signed-in user.
+func setupOwnMFA(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		u, err := currentUser(db, c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"}); return
+		}
+		out, err := startMFAEnrollment(db, cfg, u)
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+type mfaCodeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func confirmOwnMFA(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mfaCodeReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			codes, err = confirmMFAEnrollment(tx, c, c.GetString("uid"), req.Code)
+			return err
+		})
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// regenerateOwnRecoveryCodes replaces the recovery codes; a current TOTP code
+// is required so a hijacked session alone can't do it.
+func regenerateOwnRecoveryCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req mfaCodeReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		uid := c.GetString("uid")
+		var codes []string
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := checkTOTP(tx, uid, req.Code); err != nil {
+				return err
+			}
+			var err error
+			if codes, err = replaceRecoveryCodes(tx, uid); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "mfa_recovery_codes_regenerate", "user", uid, nil, gin.H{"recovery_codes": len(codes)})
+		})
+		if err != nil {
+			c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+type disableMFAReq struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// disableOwnMFA turns MFA off, unless the user's role requires it.
+func disableOwnMFA(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req disableMFAReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		u, err := currentUser(db, c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"}); return
+		}
+		if cfg.MFARequired(u.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "two-factor authentication is required for your role"}); return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"}); return
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := clearMFA(tx, u.ID); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "mfa_disable", "user", u.ID, nil, gin.H{"mfa_enabled": false})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// resetUserMFA is the admin escape hatch for a lost authenticator. The user
+// is signed out and, if their role requires MFA, re-enrolls at next login.
+func resetUserMFA(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var u models.User
+			if err := tx.Select("id").Where("id = ?", id).First(&u).Error; err != nil {
+				return err
+			}
+			if err := clearMFA(tx, id); err != nil {
+				return err
+			}
+			if err := revokeAllSessions(tx, id); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "mfa_reset", "user", id, nil, gin.H{"mfa_enabled": false})
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func clearMFA(tx *gorm.DB, userID string) error {
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+		"mfa_enabled": false, "mfa_secret": nil, "mfa_last_step": nil,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ?", userID).Delete(&models.MFARecoveryCode{}).Error
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 test secret ("12345678901234567890"); at Unix time 59 (step 1)
+// the 6-digit code is 287082.
+const (
+	testTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	testTOTPCode   = "287082"
+)
+
+func TestAcceptTOTP(t *testing.T) {
+	now := time.Unix(59, 0)
+	step := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name     string
+		lastStep *int64
+		code     string
+		want     bool
+	}{
+		{"first use", nil, testTOTPCode, true},
+		{"newer than last", step(0), testTOTPCode, true},
+		{"replayed step", step(1), testTOTPCode, false},
+		{"older than last", step(2), testTOTPCode, false},
+		{"wrong code", nil, "000000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := acceptTOTP(testTOTPSecret, tt.lastStep, tt.code, now)
+			if ok != tt.want {
+				t.Fatalf("acceptTOTP() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && got != 1 {
+				t.Errorf("acceptTOTP() step = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -5,40 +5,131 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
 )
 
-func Authn() gin.HandlerFunc {
+// Authn validates the bearer token and checks it against the user's current
+// state, so deactivated users and revoked sessions are rejected immediately.
+// API keys (Authorization: Bearer crm_... or X-API-Key) are accepted too;
+// they act as their user, limited to the permissions in their scopes.
+func Authn(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		h := c.GetHeader("Authorization")
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authnAPIKey(db, c, key)
+			return
+		}
 
 		if !strings.HasPrefix(strings.ToLower(h), "bearer ") {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid authorization header"})
 			return
 		}
 		token := strings.TrimSpace(h[7:])
+		if strings.HasPrefix(token, auth.APIKeyPrefix) {
+			authnAPIKey(db, c, token)
+			return
+		}
 		claims, err := auth.Parse(token)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return 
 		}
-		c.Set("uid", claims.UserID)
-		c.Set("role", claims.Role)
+
+		var u models.User
+		if err := db.Select("id", "role", "active", "token_version", "branch_id").
+			Where("id = ?", claims.UserID).First(&u).Error; err != nil || !u.Active || u.TokenVersion != claims.TokenVersion {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+			return
+		}
+		perms, err := permission.ForRole(db, u.Role)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		setIdentity(c, u, perms)
+		if claims.ActorID != "" && !checkImpersonator(db, c, claims.ActorID, claims.ActorTokenVersion) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "impersonation ended"})
+			return
+		}
 		c.Next()
 	}	
 }
 
-func RequireRole(roles ...string) gin.HandlerFunc {
-	allowed := map[string]struct{}{}
-	for _, r := range roles {
-		allowed[r] = struct{}{}
+func authnAPIKey(db *gorm.DB, c *gin.Context, raw string) {
+	key, u, err := verifyAPIKey(db, c, raw)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		return
 	}
+	perms, err := permission.ForRole(db, u.Role)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setIdentity(c, *u, perms.Intersect(key.Scopes))
+	c.Set("api_key_id", key.ID)
+	c.Next()
+}
+
+func setIdentity(c *gin.Context, u models.User, perms permission.Set) {
+	c.Set("uid", u.ID)
+	c.Set("role", u.Role)
+	if u.BranchID != nil {
+		c.Set("branch_id", *u.BranchID)
+	}
+	c.Set("permissions", perms)
+}
+
+// RequirePermission admits callers holding every one of perms. For API keys
+// that means both the key's scopes and its user's role grant them.
+func RequirePermission(perms ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, _ := c.Get("role")
-		if _, ok := allowed[role.(string)]; !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		have := scope.FromContext(c).Permissions
+		for _, p := range perms {
+			if !have.Has(p) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "missing_permission": p})
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// UserOnly refuses API keys and impersonation, for routes about the
+// signed-in person (their password, their MFA) that only they should use.
+func UserOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("api_key_id") != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available to api keys"})
+			return
+		}
+		if c.GetString("impersonator_id") != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not available while impersonating"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// LeadAccess answers 404 for /leads/:id/... routes when the lead is outside
+// the caller's scope, so nested handlers only ever see visible leads.
+func LeadAccess(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if id == "" {
+			c.Next()
+			return
+		}
+		ok, err := scope.FromContext(c).CanSeeLead(db, id)
+		if err != nil || !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "not found"})
 			return
 		}
 		c.Next()
 	}
-}
\ No newline at end of file
+}
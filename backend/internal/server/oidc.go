@@ -0,0 +1,387 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/models"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+const (
+	// How long the user has to finish signing in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// How long the frontend has to exchange the code it was redirected with.
+	oidcLoginCodeTTL = time.Minute
+
+	loginReasonSSONoAccount       = "sso_no_account"
+	loginReasonSSOEmailUnverified = "sso_email_unverified"
+	loginReasonSSOIdentityChanged = "sso_identity_mismatch"
+)
+
+var (
+	errSSONoAccount       = errors.New("no active account for this email")
+	errSSOEmailUnverified = errors.New("the identity provider has not verified this email")
+	errSSOIdentityChanged = errors.New("this account is linked to a different identity")
+)
+
+// oidcClient talks to the configured identity provider. Discovery happens on
+// first use, so the API still starts when the provider is unreachable.
+type oidcClient struct {
+	cfg config.Config
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDCClient(cfg config.Config) *oidcClient {
+	if cfg.OIDCIssuerURL == "" {
+		return nil
+	}
+	return &oidcClient{cfg: cfg}
+}
+
+func (o *oidcClient) setup(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.provider == nil {
+		p, err := oidc.NewProvider(ctx, o.cfg.OIDCIssuerURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc discovery: %w", err)
+		}
+		o.provider = p
+	}
+	conf := &oauth2.Config{
+		ClientID:     o.cfg.OIDCClientID,
+		ClientSecret: o.cfg.OIDCClientSecret,
+		RedirectURL:  o.cfg.OIDCRedirectURL,
+		Endpoint:     o.provider.Endpoint(),
+		Scopes:       o.cfg.OIDCScopes,
+	}
+	return conf, o.provider.Verifier(&oidc.Config{ClientID: o.cfg.OIDCClientID}), nil
+}
+
+// oidcLogin sends the browser to the identity provider using the
+// authorization code flow with PKCE. ?redirect= is a frontend path to return
+// to after sign-in.
+func oidcLogin(db *gorm.DB, oc *oidcClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if oc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "single sign-on is not configured"}); return
+		}
+		conf, _, err := oc.setup(c.Request.Context())
+		if err != nil {
+			log.Printf("oidc login: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "identity provider unavailable"}); return
+		}
+
+		state, stateHash, err := auth.NewOpaqueToken()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate state"}); return
+		}
+		nonce, _, err := auth.NewOpaqueToken()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate nonce"}); return
+		}
+		id, err := gonanoid.New(16)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate state"}); return
+		}
+		verifier := oauth2.GenerateVerifier()
+
+		row := models.OIDCLogin{
+			ID:           id,
+			StateHash:    stateHash,
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcStateTTL),
+		}
+		if r := c.Query("redirect"); isLocalPath(r) {
+			row.RedirectPath = &r
+		}
+		if err := db.Create(&row).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+
+		c.Redirect(http.StatusFound, conf.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)))
+	}
+}
+
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// oidcCallback is where the provider sends the browser back. It verifies
+// the ID token, maps it to a user and redirects to the frontend with a
+// one-time code that POST /auth/oidc/exchange turns into a session, so no
+// tokens end up in URLs.
+func oidcCallback(db *gorm.DB, cfg config.Config, oc *oidcClient) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if oc == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "single sign-on is not configured"}); return
+		}
+		fail := func(msg string) {
+			redirectToFrontend(c, cfg, url.Values{"error": {msg}})
+		}
+		if e := c.Query("error"); e != "" {
+			fail(e); return
+		}
+
+		var row models.OIDCLogin
+		if err := db.Where("state_hash = ? AND user_id IS NULL AND consumed_at IS NULL AND expires_at > ?",
+			auth.HashToken(c.Query("state")), time.Now()).First(&row).Error; err != nil {
+			fail("invalid or expired sign-in request"); return
+		}
+
+		ctx := c.Request.Context()
+		conf, verifier, err := oc.setup(ctx)
+		if err != nil {
+			log.Printf("oidc callback: %v", err)
+			fail("identity provider unavailable"); return
+		}
+		tok, err := conf.Exchange(ctx, c.Query("code"), oauth2.VerifierOption(row.CodeVerifier))
+		if err != nil {
+			log.Printf("oidc callback: exchange: %v", err)
+			fail("sign-in failed"); return
+		}
+		rawID, ok := tok.Extra("id_token").(string)
+		if !ok {
+			fail("sign-in failed"); return
+		}
+		idToken, err := verifier.Verify(ctx, rawID)
+		if err != nil || idToken.Nonce != row.Nonce {
+			log.Printf("oidc callback: verify id token: %v", err)
+			fail("sign-in failed"); return
+		}
+		var claims oidcClaims
+		if err := idToken.Claims(&claims); err != nil {
+			fail("sign-in failed"); return
+		}
+
+		code, codeHash, err := auth.NewOpaqueToken()
+		if err != nil {
+			fail("sign-in failed"); return
+		}
+		var u models.User
+		err = db.Transaction(func(tx *gorm.DB) error {
+			u, err = resolveOIDCUser(tx, c, cfg, idToken.Issuer, claims)
+			if err != nil {
+				return err
+			}
+			return tx.Model(&row).Updates(map[string]any{
+				"user_id": u.ID,
+				"login_code_hash": codeHash,
+				"expires_at": time.Now().Add(oidcLoginCodeTTL),
+			}).Error
+		})
+		if err != nil {
+			reason := ""
+			switch {
+			case errors.Is(err, errSSONoAccount):
+				reason = loginReasonSSONoAccount
+			case errors.Is(err, errSSOEmailUnverified):
+				reason = loginReasonSSOEmailUnverified
+			case errors.Is(err, errSSOIdentityChanged):
+				reason = loginReasonSSOIdentityChanged
+			default:
+				log.Printf("oidc callback: %v", err)
+				fail("sign-in failed"); return
+			}
+			var uid *string
+			if u.ID != "" {
+				uid = &u.ID
+			}
+			recordLoginAttempt(db, c, claims.Email, uid, false, reason)
+			fail(err.Error()); return
+		}
+
+		params := url.Values{"code": {code}}
+		if row.RedirectPath != nil {
+			params.Set("redirect", *row.RedirectPath)
+		}
+		redirectToFrontend(c, cfg, params)
+	}
+}
+
+// resolveOIDCUser finds the user for a verified identity. A user is linked to
+// their provider subject on first SSO login and matched on it afterwards, so
+// a reassigned email address can't take over the account.
+func resolveOIDCUser(tx *gorm.DB, c *gin.Context, cfg config.Config, issuer string, claims oidcClaims) (models.User, error) {
+	var u models.User
+	if claims.Subject == "" || claims.Email == "" {
+		return u, errSSONoAccount
+	}
+	if !claims.EmailVerified {
+		return u, errSSOEmailUnverified
+	}
+
+	err := tx.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, claims.Subject).First(&u).Error
+	if err == nil {
+		if !u.Active {
+			return u, errSSONoAccount
+		}
+		return u, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return u, err
+	}
+
+	err = tx.Where("email = ?", claims.Email).First(&u).Error
+	switch {
+	case err == nil:
+		if !u.Active {
+			return u, errSSONoAccount
+		}
+		if u.OIDCSubject != nil {
+			return u, errSSOIdentityChanged
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !cfg.OIDCAutoProvision || !emailDomainAllowed(cfg, claims.Email) {
+			return u, errSSONoAccount
+		}
+		if u, err = provisionOIDCUser(tx, c, cfg, claims); err != nil {
+			return u, err
+		}
+	default:
+		return u, err
+	}
+
+	if err := tx.Model(&models.User{}).Where("id = ?", u.ID).
+		Updates(map[string]any{"oidc_issuer": issuer, "oidc_subject": claims.Subject}).Error; err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
+func provisionOIDCUser(tx *gorm.DB, c *gin.Context, cfg config.Config, claims oidcClaims) (models.User, error) {
+	id, err := gonanoid.New(10)
+	if err != nil {
+		return models.User{}, err
+	}
+	// SSO-only accounts get a random password nobody knows; an admin can
+	// set a real one later.
+	random, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(random), bcrypt.DefaultCost)
+	if err != nil {
+		return models.User{}, err
+	}
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	u := models.User{
+		ID:           id,
+		Name:         name,
+		Email:        claims.Email,
+		Role:         cfg.OIDCDefaultRole,
+		PasswordHash: string(hash),
+		Active:       true,
+	}
+	if err := tx.Create(&u).Error; err != nil {
+		return u, err
+	}
+	c.Set("uid", u.ID)
+	return u, audit.Record(tx, c, audit.ActionCreate, "user", u.ID, nil, gin.H{
+		"name": u.Name, "email": u.Email, "role": u.Role, "provisioned_by": "oidc",
+	})
+}
+
+func emailDomainAllowed(cfg config.Config, email string) bool {
+	if len(cfg.OIDCAllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range cfg.OIDCAllowedDomains {
+		if d == domain {
+			return true
+		}
+	}
+	return false
+}
+
+type oidcExchangeReq struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// oidcExchange trades the one-time code from the callback redirect for the
+// same response /auth/login gives, including any MFA challenge.
+func oidcExchange(db *gorm.DB, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req oidcExchangeReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+
+		var row models.OIDCLogin
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("login_code_hash = ? AND consumed_at IS NULL AND expires_at > ?", auth.HashToken(req.Code), time.Now()).
+				First(&row).Error; err != nil {
+				return err
+			}
+			return tx.Model(&row).Update("consumed_at", time.Now()).Error
+		})
+		if err != nil || row.UserID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired code"}); return
+		}
+
+		var u models.User
+		if err := db.Where("id = ? AND active = TRUE", *row.UserID).First(&u).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired code"}); return
+		}
+		if wait := accountRetryAfter(u); wait > 0 {
+			recordLoginAttempt(db, c, u.Email, &u.ID, false, loginReasonLocked)
+			tooManyAttempts(c, wait)
+			return
+		}
+
+		resp, ok, err := mfaChallenge(cfg, u)
+		if !ok {
+			resp, err = completeLogin(db, c, u)
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to generate token"}); return
+		}
+		if row.RedirectPath != nil {
+			resp["redirect"] = *row.RedirectPath
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func redirectToFrontend(c *gin.Context, cfg config.Config, params url.Values) {
+	c.Redirect(http.StatusFound, strings.TrimRight(cfg.AppBaseURL, "/")+"/login/sso?"+params.Encode())
+}
+
+// isLocalPath accepts only same-origin paths, so ?redirect= can't be used to
+// bounce users to another site.
+func isLocalPath(p string) bool {
+	return strings.HasPrefix(p, "/") && !strings.HasPrefix(p, "//") && !strings.Contains(p, `\`)
+}
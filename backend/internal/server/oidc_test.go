@@ -0,0 +1,72 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/config"
+)
+
+// These identities are refused before any lookup, so no database is needed.
+func TestResolveOIDCUserRejects(t *testing.T) {
+	cfg := config.Config{OIDCAutoProvision: true}
+	tests := []struct {
+		name   string
+		claims oidcClaims
+		want   error
+	}{
+		{"no subject", oidcClaims{Email: "a@example.com", EmailVerified: true}, errSSONoAccount},
+		{"no email", oidcClaims{Subject: "sub-1", EmailVerified: true}, errSSONoAccount},
+		{"unverified email", oidcClaims{Subject: "sub-1", Email: "a@example.com"}, errSSOEmailUnverified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := resolveOIDCUser(nil, nil, cfg, "https://idp.example.com", tt.claims); !errors.Is(err, tt.want) {
+				t.Errorf("resolveOIDCUser() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailDomainAllowed(t *testing.T) {
+	cfg := config.Config{OIDCAllowedDomains: []string{"example.com"}}
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"a@example.com", true},
+		{"a@EXAMPLE.com", true},
+		{"a@other.com", false},
+		{"a@sub.example.com", false},
+		{"a@example.com@evil.com", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := emailDomainAllowed(cfg, tt.email); got != tt.want {
+			t.Errorf("emailDomainAllowed(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+	if !emailDomainAllowed(config.Config{}, "a@anything.org") {
+		t.Error("no allowed domains should allow every domain")
+	}
+}
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/leads/42", true},
+		{"/", true},
+		{"", false},
+		{"leads", false},
+		{"//evil.com/x", false},
+		{`/\evil.com`, false},
+		{"https://evil.com", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalPath(tt.path); got != tt.want {
+			t.Errorf("isLocalPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
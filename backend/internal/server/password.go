@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/mail"
+	"github.com/tim-contact/go-crm/internal/models"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+var errResetTokenInvalid = errors.New("invalid or expired reset token")
+
+type changePasswordReq struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+// changeOwnPassword lets a signed-in user change their password. Every other
+// session is signed out; the caller gets a fresh token pair back.
+func changeOwnPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req changePasswordReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+
+		var u models.User
+		if err := db.Where("id = ? AND active = TRUE", c.GetString("uid")).First(&u).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"}); return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.CurrentPassword)) != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"}); return
+		}
+		if req.CurrentPassword == req.NewPassword {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the current one"}); return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to hash password"}); return
+		}
+
+		var pair *tokenPair
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", u.ID).Update("password_hash", string(hash)).Error; err != nil {
+				return err
+			}
+			if err := revokeAllSessions(tx, u.ID); err != nil {
+				return err
+			}
+			if err := tx.Where("id = ?", u.ID).First(&u).Error; err != nil {
+				return err
+			}
+			if err := audit.Record(tx, c, "change_password", "user", u.ID, nil, gin.H{"password_changed": true}); err != nil {
+				return err
+			}
+			pair, _, err = issueSession(tx, c, u, "")
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+type forgotPasswordReq struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// forgotPassword emails a single-use reset link. It answers 202 whether or
+// not the address belongs to an account so it can't be used to probe emails.
+func forgotPassword(db *gorm.DB, cfg config.Config, mailer mail.Sender) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req forgotPasswordReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		accepted := gin.H{"message": "if the address belongs to an account, a reset link has been sent"}
+		if ipThrottled(db, c, req.Email) {
+			return
+		}
+		// Each request counts towards the IP's limit so the endpoint can't
+		// be used to flood inboxes.
+		recordLoginAttempt(db, c, req.Email, nil, false, loginReasonResetRequest)
+
+		var u models.User
+		if err := db.Where("LOWER(email) = LOWER(?) AND active = TRUE", strings.TrimSpace(req.Email)).First(&u).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				log.Printf("forgot password: lookup %s: %v", req.Email, err)
+			}
+			c.JSON(http.StatusAccepted, accepted); return
+		}
+
+		// Issue and send the link in the background so the response takes
+		// the same time whether or not the account exists.
+		ip := c.ClientIP()
+		go func() {
+			if err := sendPasswordReset(db, cfg, mailer, u, ip); err != nil {
+				log.Printf("forgot password: %s: %v", u.Email, err)
+			}
+		}()
+		c.JSON(http.StatusAccepted, accepted)
+	}
+}
+
+// sendPasswordReset invalidates the user's earlier reset links and emails a
+// new one.
+func sendPasswordReset(db *gorm.DB, cfg config.Config, mailer mail.Sender, u models.User, ip string) error {
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return err
+	}
+	id, err := gonanoid.New(16)
+	if err != nil {
+		return err
+	}
+	t := models.PasswordResetToken{
+		ID:        id,
+		UserID:    u.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(auth.PasswordResetTokenTTL),
+	}
+	if ip != "" {
+		t.RequestedIP = &ip
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Only the most recent link works.
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", u.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&t).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimRight(cfg.AppBaseURL, "/") + "/reset-password?token=" + url.QueryEscape(raw)
+	msg := mail.Message{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"Open the link below within %d minutes to choose a new one:\n\n%s\n\n"+
+			"If you didn't ask for this you can ignore this email.\n",
+			u.Name, int(auth.PasswordResetTokenTTL.Minutes()), link),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return mailer.Send(ctx, msg)
+}
+
+type resetPasswordWithTokenReq struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// resetTokenUsable reports whether t can still set a password: each token
+// works once, until it expires.
+func resetTokenUsable(t models.PasswordResetToken, now time.Time) bool {
+	return t.UsedAt == nil && !now.After(t.ExpiresAt)
+}
+
+func resetPasswordWithToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req resetPasswordWithTokenReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if ipThrottled(db, c, "") {
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to hash password"}); return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var t models.PasswordResetToken
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("token_hash = ?", auth.HashToken(req.Token)).
+				First(&t).Error; err != nil {
+				return errResetTokenInvalid
+			}
+			if !resetTokenUsable(t, time.Now()) {
+				return errResetTokenInvalid
+			}
+
+			res := tx.Model(&models.User{}).Where("id = ? AND active = TRUE", t.UserID).Update("password_hash", string(hash))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errResetTokenInvalid
+			}
+			if err := tx.Model(&t).Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+			if err := revokeAllSessions(tx, t.UserID); err != nil {
+				return err
+			}
+			// Unauthenticated request: the account owner is the actor.
+			c.Set("uid", t.UserID)
+			return audit.Record(tx, c, "reset_password", "user", t.UserID, nil, gin.H{"password_reset": true, "via": "email"})
+		})
+		if err != nil {
+			if errors.Is(err, errResetTokenInvalid) {
+				recordLoginAttempt(db, c, "", nil, false, loginReasonBadReset)
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+func TestResetTokenUsable(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	used := now.Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		tok  models.PasswordResetToken
+		want bool
+	}{
+		{"fresh", models.PasswordResetToken{ExpiresAt: now.Add(time.Minute)}, true},
+		{"already used", models.PasswordResetToken{ExpiresAt: now.Add(time.Minute), UsedAt: &used}, false},
+		{"expired", models.PasswordResetToken{ExpiresAt: now.Add(-time.Second)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resetTokenUsable(tt.tok, now); got != tt.want {
+				t.Errorf("resetTokenUsable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
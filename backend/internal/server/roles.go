@@ -0,0 +1,281 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+// adminRole always holds every permission so nobody can lock the
+// organisation out of the role editor.
+const adminRole = "admin"
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+type roleResp struct {
+	models.Role
+	Permissions []string `json:"permissions"`
+	Users       int64    `json:"users"`
+}
+
+func loadRoleResp(db *gorm.DB, r models.Role) (roleResp, error) {
+	out := roleResp{Role: r, Permissions: []string{}}
+	if err := db.Model(&models.RolePermission{}).Where("role = ?", r.Name).
+		Order("permission").Pluck("permission", &out.Permissions).Error; err != nil {
+		return out, err
+	}
+	err := db.Model(&models.User{}).Where("role = ?", r.Name).Count(&out.Users).Error
+	return out, err
+}
+
+func listRoles(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var roles []models.Role
+		if err := db.Order("is_system DESC, name ASC").Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		out := make([]roleResp, 0, len(roles))
+		for _, r := range roles {
+			rr, err := loadRoleResp(db, r)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			out = append(out, rr)
+		}
+		c.JSON(http.StatusOK, gin.H{"roles": out, "total": len(out)})
+	}
+}
+
+func listPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": permission.Catalog})
+}
+
+type roleCreateReq struct {
+	Name        string   `json:"name" binding:"required"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+func createRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req roleCreateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+		if !roleNamePattern.MatchString(req.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name must be 2-32 lowercase letters, digits, '-' or '_'"}); return
+		}
+		if err := validatePermissions(req.Permissions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if err := checkRoleGrant(scope.FromContext(c), req.Name, nil, req.Permissions); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()}); return
+		}
+
+		role := models.Role{Name: req.Name, Description: req.Description}
+		var out roleResp
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&role)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errRoleExists
+			}
+			if err := setRolePermissions(tx, role.Name, req.Permissions); err != nil {
+				return err
+			}
+			var err error
+			if out, err = loadRoleResp(tx, role); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionCreate, "role", role.Name, nil, out)
+		})
+		if err != nil {
+			if errors.Is(err, errRoleExists) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		permission.Invalidate()
+		c.JSON(http.StatusCreated, out)
+	}
+}
+
+type roleUpdateReq struct {
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"` // replaces the set when present
+}
+
+// updateRole edits a role's description and permissions, system roles
+// included, except that admin's permissions are fixed.
+func updateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		var req roleUpdateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		if req.Permissions != nil {
+			if name == adminRole {
+				c.JSON(http.StatusConflict, gin.H{"error": "the admin role always has every permission"}); return
+			}
+			if err := validatePermissions(req.Permissions); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+			}
+		}
+
+		var out roleResp
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var role models.Role
+			if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+				return err
+			}
+			before, err := loadRoleResp(tx, role)
+			if err != nil {
+				return err
+			}
+			if req.Description != nil {
+				if err := tx.Model(&role).Update("description", nilIfBlank(*req.Description)).Error; err != nil {
+					return err
+				}
+				role.Description = nilIfBlank(*req.Description)
+			}
+			if req.Permissions != nil {
+				if err := checkRoleGrant(scope.FromContext(c), name, before.Permissions, req.Permissions); err != nil {
+					return err
+				}
+				if err := setRolePermissions(tx, name, req.Permissions); err != nil {
+					return err
+				}
+			}
+			if out, err = loadRoleResp(tx, role); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionUpdate, "role", name, before, out)
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "role not found"}); return
+			}
+			if errors.Is(err, errRoleGrant) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		permission.Invalidate()
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// deleteRole removes a custom role nobody has.
+func deleteRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var role models.Role
+			if err := tx.Where("name = ?", name).First(&role).Error; err != nil {
+				return err
+			}
+			if role.IsSystem {
+				return errRoleSystem
+			}
+			before, err := loadRoleResp(tx, role)
+			if err != nil {
+				return err
+			}
+			if before.Users > 0 {
+				return errRoleInUse
+			}
+			if err := tx.Delete(&role).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionDelete, "role", name, before, nil)
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "role not found"}); return
+			case errors.Is(err, errRoleSystem), errors.Is(err, errRoleInUse):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		permission.Invalidate()
+		c.Status(http.StatusNoContent)
+	}
+}
+
+var (
+	errRoleExists = errors.New("role already exists")
+	errRoleSystem = errors.New("built-in roles can't be deleted")
+	errRoleInUse  = errors.New("role is assigned to users; move them to another role first")
+	errRoleGrant  = errors.New("forbidden")
+)
+
+// checkRoleGrant stops role editing from being a way up: role may only be
+// given permissions the caller holds, and the caller's own role can't gain
+// any it doesn't already have. current is role's permissions today (nil for
+// a new role).
+func checkRoleGrant(v scope.Viewer, role string, current, perms []string) error {
+	if missing := v.Permissions.Missing(perms); len(missing) > 0 {
+		return fmt.Errorf("%w: you don't hold %s", errRoleGrant, strings.Join(missing, ", "))
+	}
+	if role == v.Role {
+		if added := permission.NewSet(current...).Missing(perms); len(added) > 0 {
+			return fmt.Errorf("%w: you can't add %s to your own role", errRoleGrant, strings.Join(added, ", "))
+		}
+	}
+	return nil
+}
+
+func validatePermissions(perms []string) error {
+	for _, p := range perms {
+		if !permission.Valid(p) {
+			return errors.New("unknown permission " + p)
+		}
+	}
+	return nil
+}
+
+func setRolePermissions(tx *gorm.DB, role string, perms []string) error {
+	if err := tx.Where("role = ?", role).Delete(&models.RolePermission{}).Error; err != nil {
+		return err
+	}
+	rows := make([]models.RolePermission, 0, len(perms))
+	for _, p := range permission.NewSet(perms...).Names() {
+		rows = append(rows, models.RolePermission{Role: role, Permission: p})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
+
+// roleExists is the check that replaced the old fixed list of roles.
+func roleExists(db *gorm.DB, name string) bool {
+	var n int64
+	return db.Model(&models.Role{}).Where("name = ?", name).Count(&n).Error == nil && n > 0
+}
+
+// canAssignRole reports whether the caller holds every permission of role,
+// so managing users can't be used to hand out more than one has.
+func canAssignRole(db *gorm.DB, c *gin.Context, role string) (bool, error) {
+	perms, err := permission.ForRole(db, role)
+	if err != nil {
+		return false, err
+	}
+	return len(scope.FromContext(c).Permissions.Missing(perms.Names())) == 0, nil
+}
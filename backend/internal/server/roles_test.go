@@ -0,0 +1,42 @@
+package server
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/scope"
+)
+
+func TestCheckRoleGrant(t *testing.T) {
+	manager := scope.Viewer{
+		Role:        "manager",
+		Permissions: permission.NewSet(permission.RoleManage, permission.LeadRead, permission.LeadUpdate),
+	}
+	tests := []struct {
+		name    string
+		role    string
+		current []string
+		perms   []string
+		wantErr bool
+	}{
+		{"permissions the caller holds", "agent", nil, []string{permission.LeadRead}, false},
+		{"no permissions", "viewer", nil, []string{}, false},
+		{"permission the caller lacks", "agent", nil, []string{permission.LeadRead, permission.UserImpersonate}, true},
+		{"user management", "agent", []string{permission.LeadRead}, []string{permission.UserManage}, true},
+		{"own role unchanged", "manager", []string{permission.RoleManage, permission.LeadRead}, []string{permission.LeadRead, permission.RoleManage}, false},
+		{"own role narrowed", "manager", []string{permission.RoleManage, permission.LeadRead}, []string{permission.RoleManage}, false},
+		{"own role widened", "manager", []string{permission.RoleManage, permission.LeadRead}, []string{permission.RoleManage, permission.LeadUpdate}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRoleGrant(manager, tt.role, tt.current, tt.perms)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkRoleGrant() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errRoleGrant) {
+				t.Errorf("error %v is not errRoleGrant", err)
+			}
+		})
+	}
+}
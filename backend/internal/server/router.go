@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"net/http" 
 	"time"
 	"fmt"
@@ -9,49 +10,180 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/captcha"
+	"github.com/tim-contact/go-crm/internal/config"
+	"github.com/tim-contact/go-crm/internal/mail"
 	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/permission"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+	"github.com/tim-contact/go-crm/internal/picklist"
+	"github.com/tim-contact/go-crm/internal/etag"
 	"github.com/tim-contact/go-crm/internal/handlers"
+	"github.com/tim-contact/go-crm/internal/inqid"
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/leadtag"
+	"github.com/tim-contact/go-crm/internal/pipeline"
+	"github.com/tim-contact/go-crm/internal/scope"
 )
 
-func Router(r *gin.Engine, db *gorm.DB) *gin.Engine {
+func Router(r *gin.Engine, db *gorm.DB, cfg config.Config, mailer mail.Sender, verifier captcha.Verifier) *gin.Engine {
 	r.GET("/healthz", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.GET("/.well-known/jwks.json", jwks)
+
+	oc := newOIDCClient(cfg)
 
 	authg := r.Group("/auth")
 	{
-	authg.POST("/login", login(db))
-	authg.POST("/register", Authn(), RequireRole("admin"), register(db))
+	authg.POST("/login", login(db, cfg))
+	authg.POST("/refresh", refresh(db))
+	authg.POST("/logout", logout(db))
+	authg.POST("/register", Authn(db), RequirePermission(permission.UserManage), register(db))
+	authg.POST("/password/forgot", forgotPassword(db, cfg, mailer))
+	authg.POST("/password/reset", resetPasswordWithToken(db))
+	authg.POST("/mfa/verify", mfaVerify(db))
+	authg.POST("/mfa/enroll", mfaEnroll(db, cfg))
+	authg.POST("/mfa/enroll/confirm", mfaEnrollConfirm(db))
+	authg.GET("/oidc/login", oidcLogin(db, oc))
+	authg.GET("/oidc/callback", oidcCallback(db, cfg, oc))
+	authg.POST("/oidc/exchange", oidcExchange(db, cfg))
+	}
+	r.POST("/public/inquiries", createInquiry(db, cfg, verifier))
+	r.GET("/me", Authn(db), getMe(db))
+	me := r.Group("/me", Authn(db), UserOnly())
+	{
+		me.PUT("/password", changeOwnPassword(db))
+		me.POST("/mfa/setup", setupOwnMFA(db, cfg))
+		me.POST("/mfa/confirm", confirmOwnMFA(db))
+		me.POST("/mfa/recovery-codes", regenerateOwnRecoveryCodes(db))
+		me.DELETE("/mfa", disableOwnMFA(db, cfg))
 	}
 
 	noteHandler := handlers.NewLeadNoteHandler(db)
 	activityHandler := handlers.NewActivityHandler(db)
 	taskHandler := handlers.NewTaskHandler(db)
+	auditHandler := handlers.NewAuditHandler(db)
+	pipelineHandler := handlers.NewPipelineHandler(db)
+	allocationHandler := handlers.NewAllocationRuleHandler(db)
+	picklistHandler := handlers.NewPicklistHandler(db)
+	tagHandler := handlers.NewTagHandler(db)
+	branchHandler := handlers.NewBranchHandler(db)
+
+	r.GET("/tasks/today", Authn(db), RequirePermission(permission.TaskQueue), taskHandler.GetTodayTasks)
+	r.GET("/users", Authn(db), RequirePermission(permission.UserList), listUsers(db))
+	users := r.Group("/users", Authn(db), RequirePermission(permission.UserManage))
+	{
+		users.GET("/all", listAllUsers(db))
+		users.GET("/:id", getUser(db))
+		users.PUT("/:id", updateUser(db))
+		users.POST("/:id/deactivate", deactivateUser(db))
+		users.POST("/:id/reactivate", reactivateUser(db))
+		users.POST("/:id/password", resetUserPassword(db))
+		users.POST("/:id/sessions/revoke", revokeUserSessions(db))
+		users.POST("/:id/mfa/reset", resetUserMFA(db))
+		users.POST("/:id/unlock", unlockUser(db))
+		users.GET("/:id/login-attempts", listLoginAttempts(db))
+	}
+	r.POST("/users/:id/impersonate", Authn(db), UserOnly(), RequirePermission(permission.UserImpersonate), impersonateUser(db))
+	r.GET("/audit", Authn(db), RequirePermission(permission.AuditRead), auditHandler.ListAuditLogs)
+
+	apiKeys := r.Group("/api-keys", Authn(db), RequirePermission(permission.APIKeyManage))
+	{
+		apiKeys.GET("", listAPIKeys(db))
+		apiKeys.POST("", createAPIKey(db))
+		apiKeys.DELETE("/:key_id", revokeAPIKey(db))
+	}
 
-	r.GET("/tasks/today", Authn(), RequireRole("admin", "coordinator", "agent"), taskHandler.GetTodayTasks)
-	r.GET("/users", Authn(), RequireRole("admin", "coordinator", "agent"), listUsers(db))
+	roles := r.Group("/roles", Authn(db), RequirePermission(permission.RoleManage))
+	{
+		roles.GET("", listRoles(db))
+		roles.GET("/permissions", listPermissions)
+		roles.POST("", createRole(db))
+		roles.PUT("/:name", updateRole(db))
+		roles.DELETE("/:name", deleteRole(db))
+	}
 
-	lead := r.Group("/leads", Authn())
+	pipelineg := r.Group("/pipeline", Authn(db))
 	{
-		lead.POST("", RequireRole("admin", "coordinator", "agent"), createLead(db))
-		lead.GET("", RequireRole("admin", "coordinator", "agent", "viewer"), listLeads(db))
-		lead.GET(":id", RequireRole("admin", "coordinator", "agent", "viewer"), getLead(db))
-		lead.PUT(":id", RequireRole("admin", "coordinator", "agent"), updateLead(db))
-		lead.DELETE(":id", RequireRole("admin", "coordinator"), deleteLead(db))
+		pipelineg.GET("", RequirePermission(permission.PipelineRead), pipelineHandler.GetPipeline)
+		pipelineg.POST("/statuses", RequirePermission(permission.PipelineManage), pipelineHandler.CreateStatus)
+		pipelineg.PUT("/statuses/:status_id", RequirePermission(permission.PipelineManage), pipelineHandler.UpdateStatus)
+		pipelineg.DELETE("/statuses/:status_id", RequirePermission(permission.PipelineManage), pipelineHandler.DeleteStatus)
+		pipelineg.PUT("/transitions", RequirePermission(permission.PipelineManage), pipelineHandler.ReplaceTransitions)
+	}
+
+	picklists := r.Group("/picklists", Authn(db))
+	{
+		picklists.GET("", RequirePermission(permission.LeadRead), picklistHandler.ListPicklists)
+		picklists.GET("/:list", RequirePermission(permission.LeadRead), picklistHandler.GetPicklist)
+		picklists.POST("/:list", RequirePermission(permission.PicklistManage), picklistHandler.CreateOption)
+		picklists.PUT("/:list/:option_id", RequirePermission(permission.PicklistManage), picklistHandler.UpdateOption)
+		picklists.DELETE("/:list/:option_id", RequirePermission(permission.PicklistManage), picklistHandler.DeleteOption)
+	}
+
+	tags := r.Group("/tags", Authn(db))
+	{
+		tags.GET("", RequirePermission(permission.LeadRead), tagHandler.ListTags)
+		tags.POST("", RequirePermission(permission.TagManage), tagHandler.CreateTag)
+		tags.PUT("/:tag_id", RequirePermission(permission.TagManage), tagHandler.UpdateTag)
+		tags.DELETE("/:tag_id", RequirePermission(permission.TagManage), tagHandler.DeleteTag)
+	}
+
+	branches := r.Group("/branches", Authn(db))
+	{
+		branches.GET("", RequirePermission(permission.LeadRead), branchHandler.ListBranches)
+		branches.POST("", RequirePermission(permission.BranchManage), branchHandler.CreateBranch)
+		branches.PUT("/:branch_id", RequirePermission(permission.BranchManage), branchHandler.UpdateBranch)
+	}
+
+	rules := r.Group("/allocation-rules", Authn(db), RequirePermission(permission.AllocationManage))
+	{
+		rules.GET("", allocationHandler.ListRules)
+		rules.POST("", allocationHandler.CreateRule)
+		rules.PUT("/:rule_id", allocationHandler.UpdateRule)
+		rules.DELETE("/:rule_id", allocationHandler.DeleteRule)
+	}
+
+	// Trash routes sit outside the group: LeadAccess hides deleted leads.
+	r.GET("/leads/trash", Authn(db), RequirePermission(permission.LeadTrash), listDeletedLeads(db, cfg))
+	r.POST("/leads/:id/restore", Authn(db), RequirePermission(permission.LeadTrash), restoreLead(db))
+
+	lead := r.Group("/leads", Authn(db), LeadAccess(db))
+	{
+		lead.POST("", RequirePermission(permission.LeadCreate), createLead(db))
+		lead.GET("", RequirePermission(permission.LeadRead), listLeads(db))
+		lead.POST("import", RequirePermission(permission.LeadImport), importLeads(db))
+		lead.GET("export", RequirePermission(permission.LeadExport), exportLeads(db))
+		lead.POST("bulk", RequirePermission(permission.LeadBulk), bulkLeads(db))
+		lead.GET("bulk/:job_id", RequirePermission(permission.LeadBulk), getBulkJob(db))
+		lead.GET("tag-counts", RequirePermission(permission.LeadRead), leadTagCounts(db))
+		lead.GET(":id", RequirePermission(permission.LeadRead), getLead(db))
+		lead.PUT(":id", RequirePermission(permission.LeadUpdate), updateLead(db))
+		lead.DELETE(":id", RequirePermission(permission.LeadDelete), deleteLead(db))
+		lead.GET(":id/status-history", RequirePermission(permission.LeadRead), pipelineHandler.GetStatusHistory)
+		lead.GET(":id/timeline", RequirePermission(permission.LeadRead), leadTimeline(db))
+		lead.GET(":id/duplicates", RequirePermission(permission.LeadRead), listLeadDuplicates(db))
+		lead.POST(":id/merge", RequirePermission(permission.LeadMerge), mergeLeads(db))
+
+		lead.GET(":id/tags", RequirePermission(permission.LeadRead), tagHandler.GetLeadTags)
+		lead.POST(":id/tags", RequirePermission(permission.LeadUpdate), tagHandler.AddLeadTag)
+		lead.DELETE(":id/tags/:tag_id", RequirePermission(permission.LeadUpdate), tagHandler.RemoveLeadTag)
 
 		// Lead Notes
-		lead.POST(":id/notes", RequireRole("admin", "coordinator", "agent"), noteHandler.CreateLeadNote)
-		lead.GET(":id/notes", RequireRole("admin", "coordinator", "agent", "viewer"), noteHandler.GetLeadNotes)
-		lead.PUT(":id/notes/:note_id", RequireRole("admin", "coordinator", "agent"), noteHandler.UpdateLeadNote)
-		lead.DELETE(":id/notes/:note_id", RequireRole("admin", "coordinator"), noteHandler.DeleteLeadNote)
-
-		lead.POST(":id/activities", RequireRole("admin", "coordinator", "agent"), activityHandler.CreateActivity)
-		lead.GET(":id/activities", RequireRole("admin", "coordinator", "agent", "viewer"), activityHandler.GetActivities)
-		lead.PUT(":id/activities/:activity_id", RequireRole("admin", "coordinator", "agent"), activityHandler.UpdateActivity)
-		lead.DELETE(":id/activities/:activity_id", RequireRole("admin", "coordinator"), activityHandler.DeleteActivity)
-
-		lead.POST(":id/tasks", RequireRole("admin", "coordinator", "agent"), taskHandler.CreateTask)
-		lead.GET(":id/tasks", RequireRole("admin", "coordinator", "agent", "viewer"), taskHandler.GetTasks)
-		lead.PUT(":id/tasks/:task_id", RequireRole("admin", "coordinator", "agent"), taskHandler.UpdateTask)
-		lead.DELETE(":id/tasks/:task_id", RequireRole("admin", "coordinator"), taskHandler.DeleteTask)
+		lead.POST(":id/notes", RequirePermission(permission.NoteWrite), noteHandler.CreateLeadNote)
+		lead.GET(":id/notes", RequirePermission(permission.NoteRead), noteHandler.GetLeadNotes)
+		lead.PUT(":id/notes/:note_id", RequirePermission(permission.NoteWrite), noteHandler.UpdateLeadNote)
+		lead.DELETE(":id/notes/:note_id", RequirePermission(permission.NoteDelete), noteHandler.DeleteLeadNote)
+
+		lead.POST(":id/activities", RequirePermission(permission.ActivityWrite), activityHandler.CreateActivity)
+		lead.GET(":id/activities", RequirePermission(permission.ActivityRead), activityHandler.GetActivities)
+		lead.PUT(":id/activities/:activity_id", RequirePermission(permission.ActivityWrite), activityHandler.UpdateActivity)
+		lead.DELETE(":id/activities/:activity_id", RequirePermission(permission.ActivityDelete), activityHandler.DeleteActivity)
+
+		lead.POST(":id/tasks", RequirePermission(permission.TaskWrite), taskHandler.CreateTask)
+		lead.GET(":id/tasks", RequirePermission(permission.TaskRead), taskHandler.GetTasks)
+		lead.PUT(":id/tasks/:task_id", RequirePermission(permission.TaskWrite), taskHandler.UpdateTask)
+		lead.DELETE(":id/tasks/:task_id", RequirePermission(permission.TaskDelete), taskHandler.DeleteTask)
 	}
 	return r
 }
@@ -75,7 +207,12 @@ type leadCreateReq struct {
 	AllocatedUserID    *string    `json:"allocated_user_id"`
 	GroupName		  *string     `json:"group_name"`
 	Remarks			  *string     `json:"remarks"`
-
+	LeadType           *string    `json:"lead_type"`
+	ContactMethod      *string    `json:"contact_method"`
+	CCSpecialist       *string    `json:"cc_specialist"`
+	CCAllCountries     *string    `json:"cc_all_countries"`
+	SpecialComment     *string    `json:"special_comment"`
+	AllowDuplicate     bool       `json:"allow_duplicate"`
 }
 
 type userListItem struct {
@@ -83,13 +220,15 @@ type userListItem struct {
 	Name   string  `json:"name"`
 	Role   string  `json:"role"`
 	Active bool    `json:"active"`
+	BranchID *string `json:"branch_id"`
+	Team   *string `json:"team"`
 }
 
 func listUsers(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var out []userListItem
 		q := db.Table("users").
-			Select("id, name, role, active").
+			Select("id, name, role, active, branch_id, team").
 			Where("active = TRUE").
 			Order("name ASC")
 		if err := q.Scan(&out).Error; err != nil {
@@ -115,6 +254,30 @@ func createLead(db *gorm.DB) gin.HandlerFunc {
 			});
 			return
 		}
+
+		pl, err := pipeline.Load(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		if req.Status != nil && *req.Status != "" {
+			name, err := pl.Resolve(nil, *req.Status)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+			}
+			req.Status = &name
+		} else if initial, ok := pl.Initial(); ok {
+			req.Status = &initial.Name
+		}
+
+		leadType, err := picklist.Normalize(db, picklist.LeadType, nil, req.LeadType)
+		if err != nil {
+			picklistError(c, err); return
+		}
+		contactMethod, err := picklist.Normalize(db, picklist.ContactMethod, nil, req.ContactMethod)
+		if err != nil {
+			picklistError(c, err); return
+		}
+
 		m := models.Lead{
 			InqID:              req.InqID,
 			FullName:           req.FullName,
@@ -126,15 +289,71 @@ func createLead(db *gorm.DB) gin.HandlerFunc {
 			GPA:                req.GPA,
 			Team:			    req.Team,
 			GroupName:		    req.GroupName,
+			Remarks:            req.Remarks,
+			LeadType:           leadType,
+			ContactMethod:      contactMethod,
+			CCSpecialist:       req.CCSpecialist,
+			CCAllCountries:     req.CCAllCountries,
+			SpecialComment:     req.SpecialComment,
 			Status:             req.Status,
 			WhatsAppNo:         req.WhatsAppNo,
 			InquiryDate:        req.InquiryDate,
 			AllocatedUserID:    req.AllocatedUserID,
 			BranchID:           &branchID,
+			WhatsAppNoE164:     normalizeWhatsApp(req.WhatsAppNo),
 		}
-		if err := db.Create(&m).Error; err != nil {
+
+		if m.InqID = strings.TrimSpace(m.InqID); m.InqID != "" {
+			var taken int64
+			// Deleted leads keep their inq_id until purged.
+			if err := db.Unscoped().Model(&models.Lead{}).Where("inq_id = ?", m.InqID).Count(&taken).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			if taken > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "inq_id " + m.InqID + " is already in use"}); return
+			}
+		}
+
+		if !req.AllowDuplicate {
+			dups, err := findDuplicateLeads(db, m.FullName, m.WhatsAppNoE164, "")
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			if len(dups) > 0 {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "possible duplicate lead; resend with allow_duplicate=true to create anyway",
+					"duplicates": dups,
+				}); return
+			}
+		}
+
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if m.InqID == "" {
+				var err error
+				if m.InqID, err = nextInqID(tx, &m); err != nil {
+					return err
+				}
+			}
+			if err := allocateLead(tx, &m); err != nil {
+				return err
+			}
+			if err := tx.Create(&m).Error; err != nil {
+				return err
+			}
+			// Re-read so the ETag comes from the stored updated_at.
+			if err := tx.First(&m, "id = ?", m.ID).Error; err != nil {
+				return err
+			}
+			if m.Status != nil {
+				if err := pipeline.RecordChange(tx, m.ID, nil, *m.Status, c.GetString("uid")); err != nil {
+					return err
+				}
+			}
+			return audit.Record(tx, c, audit.ActionCreate, "lead", m.ID, nil, m)
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
 		}
+		c.Header("ETag", etag.FromTime(m.UpdatedAt))
 		c.JSON(http.StatusCreated, m)
 	}
 }
@@ -142,7 +361,15 @@ func createLead(db *gorm.DB) gin.HandlerFunc {
 type leadFilters struct {
 	Country     string `form:"country"`
 	Status      string `form:"status"`
+	LeadType      string `form:"lead_type"`
+	ContactMethod string `form:"contact_method"`
+	GroupName     string `form:"group_name"`
+	Team          string `form:"team"`
+	CCSpecialist   string `form:"cc_specialist"`
+	CCAllCountries string `form:"cc_all_countries"`
 	AllocatedTo string `form:"allocated_to"`
+	Tags        string `form:"tags"` // comma-separated tag IDs
+	TagMode     string `form:"tag_mode" binding:"omitempty,oneof=any all none"`
 	Q           string `form:"q"`
 	From        string `form:"from"` // YYYY-MM-DD
 	To          string `form:"to"`
@@ -154,6 +381,36 @@ type leadWithBranchResp struct {
 	models.Lead
 	BranchName string `json:"branch_name"`
 	AllocatedUserName string `json:"allocated_user_name"`
+	Tags []models.Tag `json:"tags,omitempty" gorm:"-"`
+}
+
+// leadsQuery selects leads with branch and allocated user names resolved and
+// applies f. Paging is left to the caller.
+func leadsQuery(db *gorm.DB, f leadFilters) *gorm.DB {
+	q := db.Table("leads").
+		Select("leads.*, COALESCE(branches.name, '') AS branch_name, COALESCE(u.name, '') AS allocated_user_name").
+		Joins("LEFT JOIN branches ON branches.id = leads.branch_id").
+		Joins("LEFT JOIN users u ON u.id = leads.allocated_user_id")
+
+	if f.Country != "" {
+		q = q.Where("leads.destination_country ILIKE ?", "%"+f.Country+"%")
+	}
+	if f.Status != "" { q = q.Where("leads.status = ?", f.Status) }
+	if f.LeadType != "" { q = q.Where("lower(leads.lead_type) = lower(?)", f.LeadType) }
+	if f.ContactMethod != "" { q = q.Where("lower(leads.contact_method) = lower(?)", f.ContactMethod) }
+	if f.GroupName != "" { q = q.Where("leads.group_name ILIKE ?", "%"+f.GroupName+"%") }
+	if f.Team != "" { q = q.Where("leads.team ILIKE ?", "%"+f.Team+"%") }
+	if f.CCSpecialist != "" { q = q.Where("leads.cc_specialist ILIKE ?", "%"+f.CCSpecialist+"%") }
+	if f.CCAllCountries != "" { q = q.Where("leads.cc_all_countries ILIKE ?", "%"+f.CCAllCountries+"%") }
+	if f.AllocatedTo != "" { q = q.Where("leads.allocated_user_id = ?", f.AllocatedTo) }
+	if f.Tags != "" { q = filterByTags(q, f.Tags, f.TagMode) }
+	if f.Q != "" {
+		like := "%" + f.Q + "%"
+		q = q.Where("(leads.full_name ILIKE ? OR leads.whatsapp_no ILIKE ? OR leads.whatsapp_no_e164 ILIKE ? OR leads.inq_id ILIKE ?)", like, like, like, like)
+	}
+	if f.From != "" { q = q.Where("leads.inquiry_date >= ?", f.From) }
+	if f.To != "" { q = q.Where("leads.inquiry_date <= ?", f.To) }
+	return q
 }
 
 func listLeads(db *gorm.DB) gin.HandlerFunc {
@@ -164,22 +421,7 @@ func listLeads(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filters"}); return
 		}		
 
-		q := db.Table("leads").
-			Select("leads.*, COALESCE(branches.name, '') AS branch_name, COALESCE(u.name, '') AS allocated_user_name").
-			Joins("LEFT JOIN branches ON branches.id = leads.branch_id").
-			Joins("LEFT JOIN users u ON u.id = leads.allocated_user_id")
-
-		if f.Country != "" {
-			q = q.Where("destination_country ILIKE ?", "%"+f.Country+"%")
-		}
-		if f.Status != "" { q = q.Where("status = ?", f.Status) }
-		if f.AllocatedTo != "" { q = q.Where("allocated_user_id = ?", f.AllocatedTo) }
-		if f.Q != "" {
-			like := "%" + f.Q + "%"
-			q = q.Where("(full_name ILIKE ? OR whatsapp_no ILIKE ? OR inq_id ILIKE ?)", like, like, like)
-		}
-		if f.From != "" { q = q.Where("inquiry_date >= ?", f.From) }
-		if f.To != "" { q = q.Where("inquiry_date <= ?", f.To) }
+		q := leadsQuery(db.Scopes(scope.FromContext(c).Leads("leads")), f)
 
 		if f.Limit <= 0 || f.Limit > 200 { f.Limit = 50 }
 		if f.Offset < 0 { f.Offset = 0 }
@@ -196,6 +438,9 @@ func listLeads(db *gorm.DB) gin.HandlerFunc {
 		if err := q.Order("leads.created_at DESC, leads.id DESC").Limit(f.Limit).Offset(f.Offset).Scan(&out).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
 		}
+		if err := attachTags(db, out); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
 
 		fmt.Printf("Total leads: %d, Returned: %d\n", total, len(out))
 		response := gin.H{
@@ -218,12 +463,20 @@ func getLead(db *gorm.DB) gin.HandlerFunc {
 			Joins("LEFT JOIN branches on branches.id = leads.branch_id").
 			Joins("LEFT JOIN users u ON u.id = leads.allocated_user_id").
 			Where("leads.id = ?", id).
+			Scopes(scope.FromContext(c).Leads("leads")).
 			Scan(&out).Error
 
 		if err != nil || out.ID == "" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 			return
 		}
+		tags, err := leadtag.ForLead(db, out.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out.Tags = tags
+		c.Header("ETag", etag.FromTime(out.UpdatedAt))
 		c.JSON(http.StatusOK, out)
 	}
 }
@@ -243,6 +496,13 @@ type leadUpdateReq struct {
 	InquiryDate        *time.Time `json:"inquiry_date"`
 	AllocatedUserID    *string    `json:"allocated_user_id"`
 	Branch			   *string    `json:"branch"`
+	GroupName          *string    `json:"group_name"`
+	Remarks            *string    `json:"remarks"`
+	LeadType           *string    `json:"lead_type"`
+	ContactMethod      *string    `json:"contact_method"`
+	CCSpecialist       *string    `json:"cc_specialist"`
+	CCAllCountries     *string    `json:"cc_all_countries"`
+	SpecialComment     *string    `json:"special_comment"`
 }
 
 func updateLead(db *gorm.DB) gin.HandlerFunc {
@@ -258,19 +518,66 @@ func updateLead(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, gin.H{"error": "not found"}); return
 		}
 		updates := map[string]any{}
-		if req.InqID != nil { updates["inq_id"] = req.InqID }
+		// A blank inq_id would leave the lead without a reference; keep the old one.
+		if req.InqID != nil && strings.TrimSpace(*req.InqID) != "" && strings.TrimSpace(*req.InqID) != m.InqID {
+			inqID := strings.TrimSpace(*req.InqID)
+			var taken int64
+			// Deleted leads keep their inq_id until purged.
+			if err := db.Unscoped().Model(&models.Lead{}).Where("inq_id = ? AND id <> ?", inqID, id).Count(&taken).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			if taken > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "inq_id " + inqID + " is already in use"}); return
+			}
+			updates["inq_id"] = inqID
+		}
 		if req.FullName != nil { updates["full_name"] = *req.FullName }
 		if req.DestinationCountry != nil { updates["destination_country"] = req.DestinationCountry }
-		if req.Status != nil { updates["status"] = req.Status }
+		if req.Status != nil {
+			pl, err := pipeline.Load(db)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			name, err := pl.Resolve(m.Status, *req.Status)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+			}
+			updates["status"] = name
+		}
 		if req.FieldOfStudy != nil { updates["field_of_study"] = req.FieldOfStudy }
 		if req.Age != nil { updates["age"] = req.Age}
 		if req.VisaCategory != nil { updates["visa_category"] = req.VisaCategory }
 		if req.Principal != nil { updates["principal"] = req.Principal }
 		if req.GPA != nil { updates["gpa"] = req.GPA }
 		if req.Team != nil { updates["team"] = req.Team }
-		if req.WhatsAppNo != nil { updates["whatsapp_no"] = req.WhatsAppNo }
+		if req.WhatsAppNo != nil {
+			updates["whatsapp_no"] = req.WhatsAppNo
+			updates["whatsapp_no_e164"] = normalizeWhatsApp(*req.WhatsAppNo)
+		}
 		if req.InquiryDate != nil { updates["inquiry_date"] = req.InquiryDate }
-		if req.AllocatedUserID != nil { updates["allocated_user_id"] = req.AllocatedUserID }
+		if req.GroupName != nil { updates["group_name"] = req.GroupName }
+		if req.Remarks != nil { updates["remarks"] = req.Remarks }
+		if req.LeadType != nil {
+			v, err := picklist.Normalize(db, picklist.LeadType, m.LeadType, req.LeadType)
+			if err != nil {
+				picklistError(c, err); return
+			}
+			updates["lead_type"] = v
+		}
+		if req.ContactMethod != nil {
+			v, err := picklist.Normalize(db, picklist.ContactMethod, m.ContactMethod, req.ContactMethod)
+			if err != nil {
+				picklistError(c, err); return
+			}
+			updates["contact_method"] = v
+		}
+		if req.CCSpecialist != nil { updates["cc_specialist"] = req.CCSpecialist }
+		if req.CCAllCountries != nil { updates["cc_all_countries"] = req.CCAllCountries }
+		if req.SpecialComment != nil { updates["special_comment"] = req.SpecialComment }
+		if req.AllocatedUserID != nil {
+			updates["allocated_user_id"] = req.AllocatedUserID
+			updates["allocation_reason"] = manualAllocationReason(db, c)
+		}
 		if req.Branch != nil {
 			branchID, err := resolveBranchIDByName(db, *req.Branch)
 			if err != nil {
@@ -281,21 +588,77 @@ func updateLead(db *gorm.DB) gin.HandlerFunc {
 		}	
 
 		if len(updates) == 0 {
+			if !etag.Matches(c.GetHeader("If-Match"), etag.FromTime(m.UpdatedAt)) {
+				leadPreconditionFailed(c, m); return
+			}
+			c.Header("ETag", etag.FromTime(m.UpdatedAt))
 			c.JSON(http.StatusOK, m)
 			return
 		}
 
-		if err := db.Model(&m).Updates(updates).Error; err != nil {
+		var before models.Lead
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			// The row lock makes the If-Match check and the write atomic.
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&before, "id = ?", id).Error; err != nil {
+				return err
+			}
+			if !etag.Matches(c.GetHeader("If-Match"), etag.FromTime(before.UpdatedAt)) {
+				return errPreconditionFailed
+			}
+			// Update through a throwaway model: gorm writes map values back into
+			// the model's pointer fields, which would also change before.
+			if err := tx.Model(&models.Lead{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+			m = models.Lead{}
+			if err := tx.First(&m, "id = ?", id).Error; err != nil {
+				return err
+			}
+			if m.Status != nil {
+				if err := pipeline.RecordChange(tx, m.ID, before.Status, *m.Status, c.GetString("uid")); err != nil {
+					return err
+				}
+			}
+			if err := leadhistory.Record(tx, before, m, c.GetString("uid")); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionUpdate, "lead", m.ID, before, m)
+		}); err != nil {
+			if errors.Is(err, errPreconditionFailed) {
+				leadPreconditionFailed(c, before); return
+			}
+			// Another lead took the inq_id since the check above.
+			if pgerr.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "inq_id is already in use"}); return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
 		}
+		c.Header("ETag", etag.FromTime(m.UpdatedAt))
 		c.JSON(http.StatusOK, m)
 	}
 }
 
+// deleteLead moves the lead to the trash. Its notes, activities and tasks stay
+// until the purge job removes it for good.
 func deleteLead(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
-		if err := db.Delete(&models.Lead{}, "id = ?", id).Error; err != nil {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			var m models.Lead
+			if err := tx.First(&m, "id = ?", id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil
+				}
+				return err
+			}
+			if err := tx.Model(&models.Lead{}).Where("id = ?", m.ID).Updates(map[string]any{
+				"deleted_at": time.Now(),
+				"deleted_by": c.GetString("uid"),
+			}).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionDelete, "lead", m.ID, m, nil)
+		}); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
 		}
 		c.Status(http.StatusNoContent)
@@ -328,3 +691,31 @@ func resolveBranchIDByName(db *gorm.DB, name string) (string, error) {
 	}
 	return b.ID, nil
 }
+
+// nextInqID generates an INQ ID from the lead's branch and inquiry date.
+func nextInqID(tx *gorm.DB, m *models.Lead) (string, error) {
+	at := time.Now()
+	if m.InquiryDate != nil {
+		at = *m.InquiryDate
+	}
+	return inqid.Next(tx, m.BranchID, at)
+}
+
+// picklistError answers 400 for a value that isn't a picklist option.
+func picklistError(c *gin.Context, err error) {
+	var ve *picklist.ValueError
+	if errors.As(err, &ve) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+var errPreconditionFailed = errors.New("the lead was changed by someone else; reload and try again")
+
+// leadPreconditionFailed answers a stale If-Match with the lead as it is now,
+// so the client can show what changed.
+func leadPreconditionFailed(c *gin.Context, current models.Lead) {
+	c.Header("ETag", etag.FromTime(current.UpdatedAt))
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": errPreconditionFailed.Error(), "current": current})
+}
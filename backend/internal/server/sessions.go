@@ -0,0 +1,159 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tim-contact/go-crm/internal/auth"
+	"github.com/tim-contact/go-crm/internal/models"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+var (
+	errRefreshInvalid = errors.New("invalid refresh token")
+	errRefreshReused  = errors.New("refresh token reuse detected")
+)
+
+type tokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// issueSession mints an access token plus a refresh token belonging to
+// familyID. An empty familyID starts a new session family (i.e. a new login).
+func issueSession(tx *gorm.DB, c *gin.Context, u models.User, familyID string) (*tokenPair, *models.RefreshToken, error) {
+	access, err := auth.NewAccessToken(u.ID, u.Role, u.TokenVersion, auth.AccessTokenTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := gonanoid.New(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	if familyID == "" {
+		familyID = id
+	}
+
+	rt := models.RefreshToken{
+		ID:        id,
+		UserID:    u.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+	}
+	if ua := c.Request.UserAgent(); ua != "" {
+		rt.UserAgent = &ua
+	}
+	if ip := c.ClientIP(); ip != "" {
+		rt.IP = &ip
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &tokenPair{
+		AccessToken:  access,
+		RefreshToken: raw,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, &rt, nil
+}
+
+// rotateRefreshToken consumes raw and issues a replacement in the same family.
+// Presenting an already-rotated token revokes the whole family, since it means
+// the token has been copied and used by someone else.
+func rotateRefreshToken(db *gorm.DB, c *gin.Context, raw string) (*tokenPair, *models.User, error) {
+	var pair *tokenPair
+	var user models.User
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", auth.HashToken(raw)).
+			First(&rt).Error; err != nil {
+			return errRefreshInvalid
+		}
+
+		switch err := checkRefreshToken(rt, time.Now()); {
+		case errors.Is(err, errRefreshReused):
+			reused = true
+			return nil
+		case err != nil:
+			return err
+		}
+		if err := tx.Where("id = ? AND active = TRUE", rt.UserID).First(&user).Error; err != nil {
+			return errRefreshInvalid
+		}
+
+		next, nextRT, err := issueSession(tx, c, user, rt.FamilyID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&rt).Updates(map[string]any{
+			"revoked_at":  time.Now(),
+			"replaced_by": nextRT.ID,
+		}).Error; err != nil {
+			return err
+		}
+		pair = next
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if reused {
+		if err := revokeFamilyByHash(db, auth.HashToken(raw)); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errRefreshReused
+	}
+	return pair, &user, nil
+}
+
+// checkRefreshToken reports whether rt may still be exchanged: a revoked
+// token is a reuse (it was already rotated or logged out), an expired one is
+// just invalid.
+func checkRefreshToken(rt models.RefreshToken, now time.Time) error {
+	if rt.RevokedAt != nil {
+		return errRefreshReused
+	}
+	if now.After(rt.ExpiresAt) {
+		return errRefreshInvalid
+	}
+	return nil
+}
+
+func revokeFamilyByHash(db *gorm.DB, hash string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = (SELECT family_id FROM refresh_tokens WHERE token_hash = ?) AND revoked_at IS NULL", hash).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAllSessions kills every refresh token for the user and bumps their
+// token_version so outstanding access tokens are rejected by Authn.
+func revokeAllSessions(db *gorm.DB, userID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
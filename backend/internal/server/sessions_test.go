@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tim-contact/go-crm/internal/models"
+)
+
+func TestCheckRefreshToken(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	revoked := now.Add(-time.Minute)
+
+	tests := []struct {
+		name string
+		rt   models.RefreshToken
+		want error
+	}{
+		{"live", models.RefreshToken{ExpiresAt: now.Add(time.Hour)}, nil},
+		{"expired", models.RefreshToken{ExpiresAt: now.Add(-time.Second)}, errRefreshInvalid},
+		{"rotated is reuse", models.RefreshToken{ExpiresAt: now.Add(time.Hour), RevokedAt: &revoked}, errRefreshReused},
+		{"reuse wins over expiry", models.RefreshToken{ExpiresAt: now.Add(-time.Hour), RevokedAt: &revoked}, errRefreshReused},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkRefreshToken(tt.rt, now); !errors.Is(got, tt.want) {
+				t.Errorf("checkRefreshToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
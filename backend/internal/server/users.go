@@ -0,0 +1,363 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/tim-contact/go-crm/internal/allocation"
+	"github.com/tim-contact/go-crm/internal/audit"
+	"github.com/tim-contact/go-crm/internal/leadhistory"
+	"github.com/tim-contact/go-crm/internal/models"
+	"github.com/tim-contact/go-crm/internal/pgerr"
+)
+
+type userDetail struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Email       string     `json:"email"`
+	Phone       *string    `json:"phone"`
+	Role        string     `json:"role"`
+	Active      bool       `json:"active"`
+	BranchID    *string    `json:"branch_id"`
+	BranchName  *string    `json:"branch_name"`
+	Team        *string    `json:"team"`
+	MFAEnabled  bool       `gorm:"column:mfa_enabled" json:"mfa_enabled"`
+	LockedUntil *time.Time `json:"locked_until"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func userDetailQuery(db *gorm.DB) *gorm.DB {
+	return db.Table("users").
+		Select("users.id, users.name, users.email, users.phone, users.role, users.active, users.branch_id, b.name AS branch_name, users.team, users.mfa_enabled, users.locked_until, users.last_login_at, users.created_at").
+		Joins("LEFT JOIN branches b ON b.id = users.branch_id")
+}
+
+// listAllUsers is the admin view of staff, including inactive accounts and
+// last login times. ?active=true|false narrows it.
+func listAllUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q := userDetailQuery(db).Order("users.name ASC")
+		switch c.Query("active") {
+		case "true":
+			q = q.Where("users.active = TRUE")
+		case "false":
+			q = q.Where("users.active = FALSE")
+		}
+		var out []userDetail
+		if err := q.Scan(&out).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, gin.H{"users": out, "total": len(out)})
+	}
+}
+
+func getUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var out userDetail
+		if err := userDetailQuery(db).Where("users.id = ?", c.Param("id")).Scan(&out).Error; err != nil || out.ID == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+type userUpdateReq struct {
+	Name   *string `json:"name" binding:"omitempty,min=2"`
+	Phone  *string `json:"phone"`
+	Role   *string `json:"role"`
+	Branch *string `json:"branch"` // branch name; "" clears
+	Team   *string `json:"team"`   // "" clears
+}
+
+func updateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var req userUpdateReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+
+		if req.Role != nil {
+			if !roleExists(db, *req.Role) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + *req.Role}); return
+			}
+			ok, err := canAssignRole(db, c, *req.Role)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+			}
+			if !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": "cannot assign a role with permissions you don't have"}); return
+			}
+		}
+
+		var u models.User
+		if err := db.First(&u, "id = ?", id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+		}
+		before := u
+
+		updates := map[string]any{}
+		if req.Name != nil { updates["name"] = strings.TrimSpace(*req.Name) }
+		if req.Phone != nil { updates["phone"] = nilIfBlank(*req.Phone) }
+		if req.Role != nil { updates["role"] = *req.Role }
+		if req.Team != nil { updates["team"] = nilIfBlank(*req.Team) }
+		if req.Branch != nil {
+			if strings.TrimSpace(*req.Branch) == "" {
+				updates["branch_id"] = nil
+			} else {
+				branchID, err := resolveBranchIDByName(db, *req.Branch)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid branch: " + err.Error()}); return
+				}
+				updates["branch_id"] = branchID
+			}
+		}
+		if len(updates) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"}); return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+				return err
+			}
+			// A role change alters what the user may do; make them log in again.
+			if req.Role != nil && *req.Role != before.Role {
+				if err := revokeAllSessions(tx, id); err != nil {
+					return err
+				}
+			}
+			u = models.User{}
+			if err := tx.First(&u, "id = ?", id).Error; err != nil {
+				return err
+			}
+			return audit.Record(tx, c, audit.ActionUpdate, "user", id, before, u)
+		})
+		if err != nil {
+			if pgerr.IsUniqueViolation(err) {
+				c.JSON(http.StatusConflict, gin.H{"error": "another user already has these details"}); return
+			}
+			log.Printf("update user %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"}); return
+		}
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+type deactivateUserReq struct {
+	// ReassignTo receives the user's open leads and tasks. Without it leads
+	// go back through the allocation rules and tasks are left unassigned.
+	ReassignTo *string `json:"reassign_to"`
+}
+
+type deactivateSummary struct {
+	LeadsReassigned  int `json:"leads_reassigned"`
+	LeadsUnallocated int `json:"leads_unallocated"`
+	TasksReassigned  int `json:"tasks_reassigned"`
+	TasksUnassigned  int `json:"tasks_unassigned"`
+}
+
+func deactivateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var req deactivateUserReq
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+			}
+		}
+		if id == c.GetString("uid") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot deactivate yourself"}); return
+		}
+
+		var u models.User
+		if err := db.First(&u, "id = ?", id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+		}
+
+		var target *models.User
+		if req.ReassignTo != nil && *req.ReassignTo != "" {
+			var t models.User
+			if err := db.Where("id = ? AND active = TRUE", *req.ReassignTo).First(&t).Error; err != nil || t.ID == id {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "reassign_to must be another active user"}); return
+			}
+			target = &t
+		}
+
+		var summary deactivateSummary
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", id).Update("active", false).Error; err != nil {
+				return err
+			}
+			if err := revokeAllSessions(tx, id); err != nil {
+				return err
+			}
+			var err error
+			if summary, err = handOverOpenWork(tx, c, u, target); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "deactivate", "user", id,
+				gin.H{"active": true}, gin.H{"active": false, "handover": summary})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.JSON(http.StatusOK, summary)
+	}
+}
+
+// handOverOpenWork moves a departing user's non-terminal leads and open tasks
+// to target, or (when target is nil) re-runs allocation for the leads and
+// unassigns the tasks so they show up for coordinators.
+func handOverOpenWork(tx *gorm.DB, c *gin.Context, from models.User, target *models.User) (deactivateSummary, error) {
+	var summary deactivateSummary
+
+	var leads []models.Lead
+	if err := tx.Where("allocated_user_id = ?", from.ID).
+		Where("status IS NULL OR status NOT IN (SELECT name FROM lead_statuses WHERE is_terminal)").
+		Find(&leads).Error; err != nil {
+		return summary, err
+	}
+
+	for _, l := range leads {
+		var newOwner *string
+		var reason string
+		if target != nil {
+			newOwner = &target.ID
+			reason = fmt.Sprintf("Reassigned from %s (deactivated) to %s", from.Name, target.Name)
+		} else {
+			res, err := allocation.Allocate(tx, allocation.Input{
+				BranchID:           l.BranchID,
+				DestinationCountry: l.DestinationCountry,
+				VisaCategory:       l.VisaCategory,
+			})
+			if err != nil {
+				return summary, err
+			}
+			// Allocate skips inactive members, so the departing user (already
+			// deactivated above) is never picked again.
+			if res != nil {
+				newOwner = &res.UserID
+				reason = fmt.Sprintf("Reallocated after %s was deactivated. %s", from.Name, res.Reason)
+			} else {
+				reason = fmt.Sprintf("Needs reassignment: %s was deactivated", from.Name)
+			}
+		}
+
+		if err := tx.Model(&models.Lead{}).Where("id = ?", l.ID).Updates(map[string]any{
+			"allocated_user_id": newOwner,
+			"allocation_reason": reason,
+		}).Error; err != nil {
+			return summary, err
+		}
+		if err := leadhistory.RecordField(tx, l.ID, "allocated_user_id", l.AllocatedUserID, newOwner, c.GetString("uid")); err != nil {
+			return summary, err
+		}
+		if err := audit.Record(tx, c, audit.ActionUpdate, "lead", l.ID,
+			gin.H{"allocated_user_id": from.ID}, gin.H{"allocated_user_id": newOwner, "allocation_reason": reason}); err != nil {
+			return summary, err
+		}
+		if newOwner != nil {
+			summary.LeadsReassigned++
+		} else {
+			summary.LeadsUnallocated++
+		}
+	}
+
+	var newAssignee *string
+	if target != nil {
+		newAssignee = &target.ID
+	}
+	res := tx.Model(&models.Task{}).
+		Where("assigned_to = ? AND status IN ?", from.ID, []models.TaskStatus{models.TaskStatusOpen, models.TaskStatusInProgress}).
+		Updates(map[string]any{"assigned_to": newAssignee, "version": gorm.Expr("version + 1")})
+	if res.Error != nil {
+		return summary, res.Error
+	}
+	if target != nil {
+		summary.TasksReassigned = int(res.RowsAffected)
+	} else {
+		summary.TasksUnassigned = int(res.RowsAffected)
+	}
+	return summary, nil
+}
+
+func reactivateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		err := db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.User{}).Where("id = ?", id).Update("active", true)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return audit.Record(tx, c, "reactivate", "user", id, gin.H{"active": false}, gin.H{"active": true})
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+type resetPasswordReq struct {
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+// resetUserPassword lets an admin set a new password; the user's existing
+// sessions are revoked.
+func resetUserPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var req resetPasswordReq
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "failed to hash password"}); return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			res := tx.Model(&models.User{}).Where("id = ?", id).Update("password_hash", string(hash))
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			if err := revokeAllSessions(tx, id); err != nil {
+				return err
+			}
+			return audit.Record(tx, c, "reset_password", "user", id, nil, gin.H{"password_reset": true})
+		})
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func nilIfBlank(s string) *string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+	t := strings.TrimSpace(s)
+	return &t
+}
@@ -0,0 +1,16 @@
+-- Backfill whatsapp_no_e164 for rows entered before the app normalized it.
+-- Mirrors phone.NormalizeE164 for the formats found in the legacy sheet:
+-- local 0XXXXXXXXX, bare national numbers, and 00/+ international prefixes
+-- (assumes the default +94 country code).
+UPDATE leads
+SET whatsapp_no_e164 = CASE
+    WHEN d ~ '^00[1-9][0-9]{6,14}$'  THEN '+' || substr(d, 3)
+    WHEN d ~ '^0[1-9][0-9]{5,12}$'  THEN '+94' || substr(d, 2)
+    WHEN d ~ '^[1-9][0-9]{5,9}$'    THEN '+94' || d
+    WHEN d ~ '^[1-9][0-9]{10,14}$'  THEN '+' || d
+    ELSE NULL
+END
+FROM (SELECT id AS lid, regexp_replace(whatsapp_no, '[^0-9]', '', 'g') AS d FROM leads) norm
+WHERE leads.id = norm.lid AND leads.whatsapp_no_e164 IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_leads_whatsapp_e164 ON leads (whatsapp_no_e164);
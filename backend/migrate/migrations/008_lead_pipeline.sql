@@ -0,0 +1,52 @@
+-- Managed lead status pipeline. leads.status keeps storing the status name.
+CREATE TABLE IF NOT EXISTS lead_statuses (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT NOT NULL UNIQUE,
+    position    INT NOT NULL DEFAULT 0,
+    is_initial  BOOLEAN NOT NULL DEFAULT FALSE,
+    is_terminal BOOLEAN NOT NULL DEFAULT FALSE,
+    color       TEXT,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- At most one initial status
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lead_statuses_initial ON lead_statuses (is_initial) WHERE is_initial;
+
+CREATE TABLE IF NOT EXISTS lead_status_transitions (
+    from_status_id UUID NOT NULL REFERENCES lead_statuses(id) ON DELETE CASCADE,
+    to_status_id   UUID NOT NULL REFERENCES lead_statuses(id) ON DELETE CASCADE,
+    PRIMARY KEY (from_status_id, to_status_id),
+    CHECK (from_status_id <> to_status_id)
+);
+
+CREATE TABLE IF NOT EXISTS lead_status_history (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    lead_id     UUID NOT NULL REFERENCES leads(id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status   TEXT NOT NULL,
+    changed_by  TEXT REFERENCES users(id) ON DELETE SET NULL,
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_lead_status_history_lead ON lead_status_history (lead_id, changed_at);
+
+-- Seed with the statuses the app has used so far
+INSERT INTO lead_statuses (name, position, is_initial, is_terminal, color)
+VALUES
+  ('New', 1, TRUE, FALSE, 'green'),
+  ('In Progress', 2, FALSE, FALSE, 'orange'),
+  ('Closed', 3, FALSE, TRUE, 'blue')
+ON CONFLICT (name) DO NOTHING;
+
+-- Keep any other status already present on leads valid
+INSERT INTO lead_statuses (name, position)
+SELECT s.status, 100 + row_number() OVER (ORDER BY s.status)
+FROM (SELECT DISTINCT status FROM leads WHERE status IS NOT NULL AND status <> '') s
+ON CONFLICT (name) DO NOTHING;
+
+-- Start permissive: every status can move to every other one
+INSERT INTO lead_status_transitions (from_status_id, to_status_id)
+SELECT f.id, t.id
+FROM lead_statuses f CROSS JOIN lead_statuses t
+WHERE f.id <> t.id
+ON CONFLICT DO NOTHING;
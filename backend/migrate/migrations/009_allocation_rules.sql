@@ -0,0 +1,30 @@
+-- Automatic lead allocation rules. A rule matches on any combination of
+-- branch, destination country and visa category (NULL = any) and hands the
+-- lead to one of its members by round-robin or by lightest open-task load.
+CREATE TABLE IF NOT EXISTS allocation_rules (
+    id                   UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name                 TEXT NOT NULL,
+    priority             INT NOT NULL DEFAULT 100,
+    active               BOOLEAN NOT NULL DEFAULT TRUE,
+    branch_id            UUID REFERENCES branches(id) ON DELETE CASCADE,
+    destination_country  TEXT,
+    visa_category        TEXT,
+    strategy             TEXT NOT NULL DEFAULT 'round_robin' CHECK (strategy IN ('round_robin','least_open_tasks')),
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+DROP TRIGGER IF EXISTS trg_allocation_rules_updated ON allocation_rules;
+CREATE TRIGGER trg_allocation_rules_updated
+BEFORE UPDATE ON allocation_rules
+FOR EACH ROW EXECUTE FUNCTION set_updated_at();
+
+CREATE TABLE IF NOT EXISTS allocation_rule_members (
+    rule_id          UUID NOT NULL REFERENCES allocation_rules(id) ON DELETE CASCADE,
+    user_id          TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_assigned_at TIMESTAMPTZ,
+    PRIMARY KEY (rule_id, user_id)
+);
+
+ALTER TABLE leads
+    ADD COLUMN IF NOT EXISTS allocation_reason TEXT;
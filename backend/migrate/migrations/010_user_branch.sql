@@ -0,0 +1,5 @@
+-- Users belong to a branch; coordinators and viewers see that branch's leads
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS branch_id UUID REFERENCES branches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_leads_branch ON leads (branch_id);
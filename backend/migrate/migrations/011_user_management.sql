@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS team TEXT,
+    ADD COLUMN IF NOT EXISTS last_login_at TIMESTAMPTZ;
@@ -0,0 +1,18 @@
+-- Login attempt log and account lockout
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS failed_login_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id    TEXT REFERENCES users(id) ON DELETE SET NULL,
+    email      CITEXT NOT NULL,
+    ip         TEXT,
+    user_agent TEXT,
+    success    BOOLEAN NOT NULL,
+    reason     TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_user ON login_attempts (user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts (ip, created_at);
@@ -0,0 +1,21 @@
+-- OpenID Connect single sign-on
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS oidc_issuer TEXT,
+    ADD COLUMN IF NOT EXISTS oidc_subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_identity ON users (oidc_issuer, oidc_subject);
+
+-- One row per SSO attempt: created when the browser is sent to the provider,
+-- completed by the callback, consumed when the frontend exchanges its code.
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    id              TEXT PRIMARY KEY,
+    state_hash      TEXT NOT NULL UNIQUE,
+    nonce           TEXT NOT NULL,
+    code_verifier   TEXT NOT NULL,
+    redirect_path   TEXT,
+    user_id         TEXT REFERENCES users(id) ON DELETE CASCADE,
+    login_code_hash TEXT UNIQUE,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    consumed_at     TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,18 @@
+-- API keys for machine integrations. A key acts as user_id (for data scope
+-- and attribution) but can only reach routes its scopes allow.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL UNIQUE,
+    key_hash     TEXT NOT NULL,
+    scopes       TEXT[] NOT NULL DEFAULT '{}',
+    user_id      TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_by   TEXT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip TEXT,
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user ON api_keys (user_id);
@@ -0,0 +1,80 @@
+-- Roles become rows with a permission set instead of a fixed CHECK list.
+CREATE TABLE IF NOT EXISTS roles (
+    name        TEXT PRIMARY KEY,
+    description TEXT,
+    is_system   BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       TEXT NOT NULL REFERENCES roles(name) ON UPDATE CASCADE ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description, is_system) VALUES
+    ('admin', 'Full access', TRUE),
+    ('coordinator', 'Runs a branch: manages its leads and staff tasks', TRUE),
+    ('agent', 'Works their own leads', TRUE),
+    ('viewer', 'Read-only access to their branch', TRUE)
+ON CONFLICT (name) DO NOTHING;
+
+-- Same access the hardcoded role lists gave, except task.reassign which is
+-- new: agents can only assign tasks to themselves.
+INSERT INTO role_permissions (role, permission)
+SELECT 'admin', p FROM unnest(ARRAY[
+    'lead.read','lead.read_branch','lead.read_all','lead.create','lead.update','lead.delete',
+    'lead.import','lead.export','lead.merge',
+    'note.read','note.write','note.delete',
+    'activity.read','activity.write','activity.delete',
+    'task.read','task.write','task.delete','task.reassign','task.queue','task.queue_others',
+    'user.list','user.manage','role.manage',
+    'audit.read','pipeline.read','pipeline.manage','allocation.manage','apikey.manage'
+]) AS p
+UNION ALL
+SELECT 'coordinator', p FROM unnest(ARRAY[
+    'lead.read','lead.read_branch','lead.create','lead.update','lead.delete',
+    'lead.import','lead.export','lead.merge',
+    'note.read','note.write','note.delete',
+    'activity.read','activity.write','activity.delete',
+    'task.read','task.write','task.delete','task.reassign','task.queue','task.queue_others',
+    'user.list','pipeline.read'
+]) AS p
+UNION ALL
+SELECT 'agent', p FROM unnest(ARRAY[
+    'lead.read','lead.create','lead.update',
+    'note.read','note.write',
+    'activity.read','activity.write',
+    'task.read','task.write','task.queue',
+    'user.list','pipeline.read'
+]) AS p
+UNION ALL
+SELECT 'viewer', p FROM unnest(ARRAY[
+    'lead.read','lead.read_branch','note.read','activity.read','task.read','pipeline.read'
+]) AS p
+ON CONFLICT DO NOTHING;
+
+-- Any role already in use (there shouldn't be others) keeps working.
+INSERT INTO roles (name) SELECT DISTINCT role FROM users ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
+
+-- API key scopes are now permission names.
+UPDATE api_keys SET scopes = (
+    SELECT COALESCE(array_agg(CASE s
+        WHEN 'leads:read' THEN 'lead.read'
+        WHEN 'leads:create' THEN 'lead.create'
+        WHEN 'leads:update' THEN 'lead.update'
+        WHEN 'leads:import' THEN 'lead.import'
+        WHEN 'leads:export' THEN 'lead.export'
+        WHEN 'notes:read' THEN 'note.read'
+        WHEN 'notes:write' THEN 'note.write'
+        WHEN 'tasks:read' THEN 'task.read'
+        WHEN 'tasks:write' THEN 'task.write'
+        WHEN 'pipeline:read' THEN 'pipeline.read'
+        ELSE s END), '{}')
+    FROM unnest(scopes) AS s
+);
@@ -0,0 +1,9 @@
+-- Admin impersonation: who was really acting when a change was made while
+-- viewing as another user.
+ALTER TABLE audit_logs
+    ADD COLUMN IF NOT EXISTS impersonator_id TEXT REFERENCES users(id);
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_impersonator ON audit_logs (impersonator_id) WHERE impersonator_id IS NOT NULL;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'user.impersonate')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,23 @@
+-- Public inquiry form: where a lead came from, and a log of submissions for
+-- per-IP rate limiting.
+ALTER TABLE leads
+    ADD COLUMN IF NOT EXISTS source       TEXT,
+    ADD COLUMN IF NOT EXISTS utm_source   TEXT,
+    ADD COLUMN IF NOT EXISTS utm_medium   TEXT,
+    ADD COLUMN IF NOT EXISTS utm_campaign TEXT,
+    ADD COLUMN IF NOT EXISTS utm_term     TEXT,
+    ADD COLUMN IF NOT EXISTS utm_content  TEXT,
+    ADD COLUMN IF NOT EXISTS referrer     TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_leads_source ON leads (source);
+
+CREATE TABLE IF NOT EXISTS inquiry_submissions (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ip         TEXT NOT NULL,
+    user_agent TEXT,
+    outcome    TEXT NOT NULL,
+    lead_id    UUID REFERENCES leads(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_inquiry_submissions_ip ON inquiry_submissions (ip, created_at);
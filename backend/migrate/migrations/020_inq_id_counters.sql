@@ -0,0 +1,12 @@
+-- Server-generated INQ IDs. One counter per rendered pattern scope, e.g.
+-- "COL-2025-{SEQ}", incremented with a row lock inside the lead's transaction.
+ALTER TABLE branches
+    ADD COLUMN IF NOT EXISTS code TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_branches_code ON branches (upper(code)) WHERE code IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS inq_id_counters (
+    scope      TEXT PRIMARY KEY,
+    last_value BIGINT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,40 @@
+-- Managed picklists for lead fields that used to be free text.
+-- leads keeps storing the option value, like leads.status.
+CREATE TABLE IF NOT EXISTS picklist_options (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    list       TEXT NOT NULL CHECK (list IN ('contact_method', 'lead_type')),
+    value      TEXT NOT NULL,
+    position   INT NOT NULL DEFAULT 0,
+    active     BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_picklist_options_value ON picklist_options (list, lower(value));
+
+INSERT INTO picklist_options (list, value, position)
+VALUES
+  ('contact_method', 'WhatsApp', 1),
+  ('contact_method', 'Phone Call', 2),
+  ('contact_method', 'Walk-in', 3),
+  ('contact_method', 'Email', 4),
+  ('contact_method', 'Social Media', 5)
+ON CONFLICT DO NOTHING;
+
+-- Keep every value already present on leads valid
+INSERT INTO picklist_options (list, value, position)
+SELECT 'contact_method', v.value, 100 + row_number() OVER (ORDER BY v.value)
+FROM (SELECT DISTINCT ON (lower(contact_method)) contact_method AS value FROM leads
+      WHERE contact_method IS NOT NULL AND btrim(contact_method) <> '') v
+ON CONFLICT DO NOTHING;
+
+INSERT INTO picklist_options (list, value, position)
+SELECT 'lead_type', v.value, 100 + row_number() OVER (ORDER BY v.value)
+FROM (SELECT DISTINCT ON (lower(lead_type)) lead_type AS value FROM leads
+      WHERE lead_type IS NOT NULL AND btrim(lead_type) <> '') v
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_leads_contact_method ON leads (contact_method);
+CREATE INDEX IF NOT EXISTS idx_leads_lead_type ON leads (lead_type);
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'picklist.manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,25 @@
+-- Soft delete for leads. Deleted leads keep their notes, activities and tasks
+-- until the retention window passes and the purge job removes them for real.
+ALTER TABLE leads
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_leads_deleted_at ON leads (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE OR REPLACE VIEW v_lead_summary AS
+SELECT
+  l.id,
+  l.inq_id,
+  l.full_name,
+  l.destination_country,
+  l.status,
+  l.inquiry_date,
+  u.name AS allocated_to,
+  b.name AS branch
+FROM leads l
+LEFT JOIN users u ON u.id = l.allocated_user_id
+LEFT JOIN branches b ON b.id = l.branch_id
+WHERE l.deleted_at IS NULL;
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'lead.trash')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Optimistic concurrency for tasks: every update bumps version, which is
+-- served as the task's ETag.
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,49 @@
+-- Per-field history of lead edits, shown on the lead timeline. Status moves
+-- stay in lead_status_history.
+CREATE TABLE IF NOT EXISTS lead_field_changes (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    lead_id    UUID NOT NULL REFERENCES leads(id) ON DELETE CASCADE,
+    field      TEXT NOT NULL,
+    old_value  TEXT,
+    new_value  TEXT,
+    changed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_lead_field_changes_lead ON lead_field_changes (lead_id, changed_at);
+
+-- Backfill from the lead updates already in the audit log
+INSERT INTO lead_field_changes (lead_id, field, old_value, new_value, changed_by, changed_at)
+SELECT l.id, n.key, a.before -> n.key #>> '{}', n.value #>> '{}',
+       (SELECT u.id FROM users u WHERE u.id = a.actor_id), a.created_at
+FROM audit_logs a
+JOIN leads l ON l.id::text = a.entity_id
+CROSS JOIN LATERAL jsonb_each(a.after) n
+WHERE a.entity = 'lead'
+  AND a.action = 'update'
+  AND jsonb_typeof(a.before) = 'object'
+  AND jsonb_typeof(a.after) = 'object'
+  AND a.before -> n.key IS NOT NULL
+  AND a.before -> n.key IS DISTINCT FROM n.value
+  AND n.key NOT IN ('id', 'status', 'whatsapp_no_e164', 'allocation_reason',
+                    'created_at', 'updated_at', 'deleted_at', 'deleted_by');
+
+-- When and by whom a task was completed, for the timeline
+ALTER TABLE tasks
+    ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS completed_by TEXT REFERENCES users(id) ON DELETE SET NULL;
+
+UPDATE tasks t
+SET completed_at = a.created_at,
+    completed_by = (SELECT u.id FROM users u WHERE u.id = a.actor_id)
+FROM (
+    SELECT DISTINCT ON (entity_id) entity_id, created_at, actor_id
+    FROM audit_logs
+    WHERE entity = 'task' AND action = 'update'
+      AND after ->> 'status' = 'done'
+      AND COALESCE(before ->> 'status', '') <> 'done'
+    ORDER BY entity_id, created_at DESC
+) a
+WHERE t.id::text = a.entity_id
+  AND t.status = 'done'
+  AND t.completed_at IS NULL;
@@ -0,0 +1,24 @@
+-- Bulk lead operations too large to run inside one request run as jobs; the
+-- row tracks progress and collects the per-lead results.
+CREATE TABLE IF NOT EXISTS lead_bulk_jobs (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    operation   TEXT NOT NULL,
+    value       TEXT,
+    status      TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'done', 'failed')),
+    total       INT NOT NULL,
+    processed   INT NOT NULL DEFAULT 0,
+    succeeded   INT NOT NULL DEFAULT 0,
+    failed      INT NOT NULL DEFAULT 0,
+    results     JSONB NOT NULL DEFAULT '[]',
+    error       TEXT,
+    created_by  TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_lead_bulk_jobs_created_by ON lead_bulk_jobs (created_by, created_at DESC);
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('admin', 'lead.bulk'),
+  ('coordinator', 'lead.bulk')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,25 @@
+-- Tags replace the free-text group_name/remarks conventions for labelling
+-- leads. A lead can carry any number of tags.
+CREATE TABLE IF NOT EXISTS tags (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name       TEXT NOT NULL,
+    color      TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_name ON tags (lower(name));
+
+CREATE TABLE IF NOT EXISTS lead_tags (
+    lead_id    UUID NOT NULL REFERENCES leads(id) ON DELETE CASCADE,
+    tag_id     UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (lead_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lead_tags_tag ON lead_tags (tag_id);
+
+INSERT INTO role_permissions (role, permission) VALUES
+  ('admin', 'tag.manage'),
+  ('coordinator', 'tag.manage')
+ON CONFLICT DO NOTHING;
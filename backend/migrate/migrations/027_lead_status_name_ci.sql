@@ -0,0 +1,18 @@
+-- Status names are matched case-insensitively (pipeline.Lookup), so make
+-- them unique that way too. Existing duplicates that differ only in case
+-- get a numeric suffix, on the leads in them as well.
+WITH d AS (
+    SELECT id, name, row_number() OVER (PARTITION BY lower(name) ORDER BY created_at, id) AS n
+    FROM lead_statuses
+)
+UPDATE leads l SET status = d.name || ' (' || d.n || ')'
+FROM d WHERE d.n > 1 AND l.status = d.name;
+
+WITH d AS (
+    SELECT id, name, row_number() OVER (PARTITION BY lower(name) ORDER BY created_at, id) AS n
+    FROM lead_statuses
+)
+UPDATE lead_statuses s SET name = d.name || ' (' || d.n || ')'
+FROM d WHERE d.id = s.id AND d.n > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_lead_statuses_name_ci ON lead_statuses (lower(name));
@@ -0,0 +1,5 @@
+-- Branches can be created and edited directly, including the code used
+-- for {BRANCH} in generated INQ IDs.
+INSERT INTO role_permissions (role, permission) VALUES
+  ('admin', 'branch.manage')
+ON CONFLICT DO NOTHING;
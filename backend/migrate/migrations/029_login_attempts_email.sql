@@ -0,0 +1,2 @@
+-- Failed logins for emails with no account are counted per email.
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts (email, created_at);